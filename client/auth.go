@@ -0,0 +1,95 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"sync"
+)
+
+// Authenticator adds credentials to outgoing push requests
+type Authenticator interface {
+	Authenticate(req *http.Request) error
+}
+
+// Refresher is implemented by authenticators whose credentials can be renewed.
+// LokiClient calls Refresh once per Send when Loki responds with HTTP 401,
+// then repeats the request with the new credentials.
+type Refresher interface {
+	Refresh(ctx context.Context) error
+}
+
+// BasicAuth authenticates requests with HTTP basic auth
+type BasicAuth struct {
+	User     string
+	Password string
+}
+
+func (a BasicAuth) Authenticate(req *http.Request) error {
+	req.SetBasicAuth(a.User, a.Password)
+	return nil
+}
+
+// BearerToken authenticates requests with a static bearer token,
+// e.g. a Grafana Cloud access policy token
+type BearerToken string
+
+func (t BearerToken) Authenticate(req *http.Request) error {
+	req.Header.Set("Authorization", "Bearer "+string(t))
+	return nil
+}
+
+// StaticHeader authenticates requests with a fixed header, e.g. an API key for a gateway
+type StaticHeader struct {
+	Name  string
+	Value string
+}
+
+func (h StaticHeader) Authenticate(req *http.Request) error {
+	req.Header.Set(h.Name, h.Value)
+	return nil
+}
+
+// RotatingToken authenticates requests with a bearer token obtained from a callback.
+// The token is fetched lazily, cached, and fetched again when Loki responds with 401.
+type RotatingToken struct {
+	fetch func(ctx context.Context) (string, error)
+
+	mu    sync.Mutex
+	token string
+}
+
+// NewRotatingToken creates a RotatingToken that obtains tokens from fetch
+func NewRotatingToken(fetch func(ctx context.Context) (string, error)) *RotatingToken {
+	return &RotatingToken{fetch: fetch}
+}
+
+func (r *RotatingToken) Authenticate(req *http.Request) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.token == "" {
+		token, err := r.fetch(req.Context())
+		if err != nil {
+			return err
+		}
+		r.token = token
+	}
+
+	req.Header.Set("Authorization", "Bearer "+r.token)
+	return nil
+}
+
+// Refresh discards the cached token and fetches a new one
+func (r *RotatingToken) Refresh(ctx context.Context) error {
+	token, err := r.fetch(ctx)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err != nil {
+		r.token = ""
+		return err
+	}
+	r.token = token
+	return nil
+}
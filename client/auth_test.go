@@ -0,0 +1,103 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	clouderrors "github.com/mwazovzky/cloudlog/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// headerServer records the request headers of each push
+func headerServer(t *testing.T, status func(r *http.Request) int) (*httptest.Server, *[]http.Header) {
+	var headers []http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers = append(headers, r.Header.Clone())
+		w.WriteHeader(status(r))
+	}))
+	t.Cleanup(server.Close)
+	return server, &headers
+}
+
+func noContent(*http.Request) int { return http.StatusNoContent }
+
+func TestAuth_Strategies(t *testing.T) {
+	testCases := []struct {
+		name   string
+		user   string
+		token  string
+		opts   []LokiClientOption
+		header string
+		want   string
+	}{
+		{"DefaultBasic", "user", "secret", nil, "Authorization", "Basic dXNlcjpzZWNyZXQ="},
+		{"NoCredentials", "", "", nil, "Authorization", ""},
+		{"Bearer", "", "", []LokiClientOption{WithAuth(BearerToken("glc_abc"))}, "Authorization", "Bearer glc_abc"},
+		{"BearerOverridesBasic", "user", "secret", []LokiClientOption{WithAuth(BearerToken("glc_abc"))}, "Authorization", "Bearer glc_abc"},
+		{"StaticHeader", "", "", []LokiClientOption{WithAuth(StaticHeader{Name: "X-Api-Key", Value: "k1"})}, "X-Api-Key", "k1"},
+		{"ExplicitNone", "user", "secret", []LokiClientOption{WithAuth(nil)}, "Authorization", ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			server, headers := headerServer(t, noContent)
+			client := NewLokiClient(server.URL, tc.user, tc.token, server.Client(), tc.opts...)
+
+			require.NoError(t, client.Send(context.Background(), newTestEntry()))
+			require.Len(t, *headers, 1)
+			assert.Equal(t, tc.want, (*headers)[0].Get(tc.header))
+		})
+	}
+}
+
+func TestAuth_RotatingTokenRefreshesOn401(t *testing.T) {
+	server, headers := headerServer(t, func(r *http.Request) int {
+		if r.Header.Get("Authorization") != "Bearer token-2" {
+			return http.StatusUnauthorized
+		}
+		return http.StatusNoContent
+	})
+
+	var fetches atomic.Int32
+	auth := NewRotatingToken(func(context.Context) (string, error) {
+		return fmt.Sprintf("token-%d", fetches.Add(1)), nil
+	})
+	client := NewLokiClient(server.URL, "", "", server.Client(), WithAuth(auth))
+
+	require.NoError(t, client.Send(context.Background(), newTestEntry()))
+	require.NoError(t, client.Send(context.Background(), newTestEntry()))
+
+	assert.Equal(t, int32(2), fetches.Load(), "token is cached between sends")
+	require.Len(t, *headers, 3)
+	assert.Equal(t, "Bearer token-1", (*headers)[0].Get("Authorization"))
+	assert.Equal(t, "Bearer token-2", (*headers)[1].Get("Authorization"))
+	assert.Equal(t, "Bearer token-2", (*headers)[2].Get("Authorization"))
+}
+
+func TestAuth_RotatingTokenRefreshesOnlyOnce(t *testing.T) {
+	server, headers := headerServer(t, func(*http.Request) int { return http.StatusUnauthorized })
+
+	auth := NewRotatingToken(func(context.Context) (string, error) { return "rejected", nil })
+	client := NewLokiClient(server.URL, "", "", server.Client(), WithAuth(auth), WithRetry(fastRetry))
+
+	err := client.Send(context.Background(), newTestEntry())
+	assert.True(t, clouderrors.IsResponseError(err))
+	assert.Len(t, *headers, 2)
+}
+
+func TestAuth_RotatingTokenFetchError(t *testing.T) {
+	server, headers := headerServer(t, noContent)
+
+	auth := NewRotatingToken(func(context.Context) (string, error) { return "", fmt.Errorf("vault sealed") })
+	client := NewLokiClient(server.URL, "", "", server.Client(), WithAuth(auth))
+
+	err := client.Send(context.Background(), newTestEntry())
+	assert.ErrorIs(t, err, clouderrors.ErrInvalidInput)
+	assert.Contains(t, err.Error(), "vault sealed")
+	assert.Empty(t, *headers)
+}
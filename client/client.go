@@ -7,8 +7,10 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"time"
 
 	"github.com/mwazovzky/cloudlog/errors"
+	"github.com/mwazovzky/cloudlog/metrics"
 )
 
 // LogSender defines the interface for sending log entries to backends
@@ -22,11 +24,34 @@ type LokiStream struct {
 	Values [][]string        `json:"values"`
 }
 
+// TenantLabel is a reserved stream label carrying the Loki tenant of an entry.
+// Senders remove it from the stream labels and set LokiEntry.Tenant instead.
+const TenantLabel = "__tenant_id__"
+
 // LokiEntry represents the full payload for Loki's push API
 type LokiEntry struct {
 	Streams []LokiStream `json:"streams"`
+	// Tenant is sent as X-Scope-OrgID; empty means the client's default tenant
+	Tenant string `json:"-"`
 }
 
+const (
+	// maxResponseBody limits how much of an error response body is read
+	maxResponseBody = 64 * 1024
+	// maxBodyExcerpt limits how much of an error response body is kept
+	maxBodyExcerpt = 4096
+)
+
+// Encoding selects the wire format used for Loki push requests
+type Encoding int
+
+const (
+	// EncodingJSON posts LokiEntry as JSON (default)
+	EncodingJSON Encoding = iota
+	// EncodingProtobuf posts a snappy-compressed logproto.PushRequest
+	EncodingProtobuf
+)
+
 // HTTPClient is an interface that matches http.Client's Do method
 type HTTPClient interface {
 	Do(req *http.Request) (*http.Response, error)
@@ -35,46 +60,252 @@ type HTTPClient interface {
 // LokiClient sends log entries to Grafana Loki
 type LokiClient struct {
 	url    string
-	user   string
-	token  string
+	auth   Authenticator
 	client HTTPClient
+	retry  RetryPolicy
+	tenant string
+
+	encoding             Encoding
+	gzip                 *gzipCompressor
+	compressionThreshold int
+
+	metrics *metrics.Registry
 }
 
-// NewLokiClient creates a new LokiClient
-func NewLokiClient(url, user, token string, httpClient HTTPClient) *LokiClient {
-	return &LokiClient{
+// LokiClientOption configures a LokiClient
+type LokiClientOption func(*LokiClient)
+
+// NewLokiClient creates a new LokiClient. Requests use basic auth with user and
+// token unless both are empty; WithAuth selects a different Authenticator.
+func NewLokiClient(url, user, token string, httpClient HTTPClient, options ...LokiClientOption) *LokiClient {
+	c := &LokiClient{
 		url:    url,
-		user:   user,
-		token:  token,
 		client: httpClient,
+
+		compressionThreshold: defaultCompressionThreshold,
+	}
+
+	if user != "" || token != "" {
+		c.auth = BasicAuth{User: user, Password: token}
+	}
+
+	for _, option := range options {
+		option(c)
+	}
+
+	return c
+}
+
+// WithAuth sets the Authenticator used for push requests, replacing basic auth.
+// A nil Authenticator sends requests without credentials.
+func WithAuth(auth Authenticator) LokiClientOption {
+	return func(c *LokiClient) {
+		c.auth = auth
+	}
+}
+
+// WithRetry enables retries with exponential backoff for transient failures
+func WithRetry(policy RetryPolicy) LokiClientOption {
+	return func(c *LokiClient) {
+		c.retry = policy
+	}
+}
+
+// WithTenant sets the default tenant sent as X-Scope-OrgID for entries
+// that do not carry their own tenant
+func WithTenant(tenant string) LokiClientOption {
+	return func(c *LokiClient) {
+		c.tenant = tenant
+	}
+}
+
+// WithEncoding selects the push request wire format
+func WithEncoding(encoding Encoding) LokiClientOption {
+	return func(c *LokiClient) {
+		c.encoding = encoding
+	}
+}
+
+// WithGzip enables gzip compression of push payloads at the given level
+// (gzip.HuffmanOnly..gzip.BestCompression). Invalid levels fall back to
+// gzip.DefaultCompression. Protobuf payloads are already snappy-compressed
+// and are never gzipped.
+func WithGzip(level int) LokiClientOption {
+	return func(c *LokiClient) {
+		c.gzip = newGzipCompressor(level)
+	}
+}
+
+// WithCompressionThreshold sets the payload size in bytes below which bodies
+// are sent uncompressed. It only has an effect together with WithGzip.
+func WithCompressionThreshold(size int) LokiClientOption {
+	return func(c *LokiClient) {
+		if size >= 0 {
+			c.compressionThreshold = size
+		}
+	}
+}
+
+// WithMetrics records every push attempt (status code, body size, duration) in the registry
+func WithMetrics(registry *metrics.Registry) LokiClientOption {
+	return func(c *LokiClient) {
+		c.metrics = registry
 	}
 }
 
-// Send sends a pre-constructed Loki entry to the Loki server
+// Send sends a pre-constructed Loki entry to the Loki server.
+// Transient failures are retried according to the configured RetryPolicy.
 func (c *LokiClient) Send(ctx context.Context, entry LokiEntry) error {
-	lokiData, err := json.Marshal(entry)
+	body, err := c.encode(entry)
 	if err != nil {
-		return fmt.Errorf("%w: failed to format Loki payload: %v", errors.ErrInvalidFormat, err)
+		return err
+	}
+
+	tenant := entry.Tenant
+	if tenant == "" {
+		tenant = c.tenant
+	}
+
+	refreshed := false
+	for attempt := 1; ; attempt++ {
+		sendErr := c.push(ctx, body, tenant)
+		if sendErr == nil {
+			return nil
+		}
+		sendErr.Attempts = attempt
+		sendErr.Streams = len(entry.Streams)
+
+		// Expired credentials are renewed once, without consuming a retry attempt
+		if refresher, ok := c.auth.(Refresher); ok && sendErr.StatusCode == http.StatusUnauthorized && !refreshed {
+			refreshed = true
+			if refresher.Refresh(ctx) == nil {
+				attempt--
+				continue
+			}
+		}
+
+		if !sendErr.Retryable || attempt >= c.retry.MaxAttempts {
+			return sendErr
+		}
+		delay := c.retry.Backoff(attempt)
+		if retryAfter, ok := errors.RetryAfter(sendErr); ok && retryAfter > delay {
+			delay = retryAfter
+		}
+		if !wait(ctx, delay) {
+			return sendErr
+		}
+	}
+}
+
+// payload is an encoded push request body with its HTTP content headers
+type payload struct {
+	data            []byte
+	contentType     string
+	contentEncoding string
+}
+
+// encode serializes the entry in the configured wire format, compressing it if enabled
+func (c *LokiClient) encode(entry LokiEntry) (payload, error) {
+	if c.encoding == EncodingProtobuf {
+		data, err := encodePushRequest(entry)
+		if err != nil {
+			return payload{}, fmt.Errorf("%w: failed to encode Loki payload: %v", errors.ErrInvalidFormat, err)
+		}
+		return payload{data: snappyEncode(data), contentType: "application/x-protobuf"}, nil
 	}
 
-	req, err := http.NewRequestWithContext(ctx, "POST", c.url, bytes.NewBuffer(lokiData))
+	data, err := json.Marshal(entry)
 	if err != nil {
-		return fmt.Errorf("%w: failed to create request: %v", errors.ErrInvalidInput, err)
+		return payload{}, fmt.Errorf("%w: failed to format Loki payload: %v", errors.ErrInvalidFormat, err)
 	}
 
-	req.Header.Set("Content-Type", "application/json")
-	req.SetBasicAuth(c.user, c.token)
+	if c.gzip == nil || len(data) < c.compressionThreshold {
+		return payload{data: data, contentType: "application/json"}, nil
+	}
 
+	compressed, err := c.gzip.compress(data)
+	if err != nil {
+		return payload{}, fmt.Errorf("%w: failed to compress Loki payload: %v", errors.ErrInvalidFormat, err)
+	}
+	return payload{data: compressed, contentType: "application/json", contentEncoding: "gzip"}, nil
+}
+
+// push performs a single HTTP attempt, returning a SendError without
+// Attempts and Streams set on failure.
+func (c *LokiClient) push(ctx context.Context, body payload, tenant string) *errors.SendError {
+	req, err := http.NewRequestWithContext(ctx, "POST", c.url, bytes.NewReader(body.data))
+	if err != nil {
+		return &errors.SendError{
+			Err:      fmt.Errorf("%w: failed to create request: %v", errors.ErrInvalidInput, err),
+			Endpoint: c.url,
+		}
+	}
+
+	req.Header.Set("Content-Type", body.contentType)
+	if body.contentEncoding != "" {
+		req.Header.Set("Content-Encoding", body.contentEncoding)
+	}
+	if tenant != "" {
+		req.Header.Set("X-Scope-OrgID", tenant)
+	}
+	if c.auth != nil {
+		if err := c.auth.Authenticate(req); err != nil {
+			return &errors.SendError{
+				Err:      fmt.Errorf("%w: failed to authenticate request: %v", errors.ErrInvalidInput, err),
+				Endpoint: c.url,
+			}
+		}
+	}
+
+	start := time.Now()
 	resp, err := c.client.Do(req)
 	if err != nil {
-		return fmt.Errorf("%w: %v", errors.ErrConnectionFailed, err)
+		c.observe(0, body, start)
+		return &errors.SendError{
+			Err:       fmt.Errorf("%w: %v", errors.ErrConnectionFailed, err),
+			Endpoint:  c.url,
+			Retryable: ctx.Err() == nil,
+		}
 	}
 	defer func() { _ = resp.Body.Close() }()
+	c.observe(resp.StatusCode, body, start)
+
+	if resp.StatusCode < 400 {
+		return nil
+	}
 
-	if resp.StatusCode >= 400 {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("%w: status code %d: %s", errors.ErrResponseError, resp.StatusCode, string(body))
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, maxResponseBody))
+	excerpt := string(data)
+	if len(excerpt) > maxBodyExcerpt {
+		excerpt = excerpt[:maxBodyExcerpt]
 	}
 
-	return nil
+	sendErr := &errors.SendError{
+		StatusCode: resp.StatusCode,
+		Body:       excerpt,
+		Endpoint:   c.url,
+		Retryable:  isRetryableStatus(resp.StatusCode),
+	}
+
+	if resp.StatusCode == http.StatusTooManyRequests {
+		sendErr.Err = &errors.RateLimitError{
+			RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
+			Body:       excerpt,
+		}
+	} else {
+		sendErr.Err = fmt.Errorf("%w: status code %d: %s", errors.ErrResponseError, resp.StatusCode, excerpt)
+	}
+
+	if resp.StatusCode == http.StatusBadRequest {
+		sendErr.Rejections = parseRejections(string(data))
+	}
+
+	return sendErr
+}
+
+// observe records a push attempt in the metrics registry, if configured
+func (c *LokiClient) observe(statusCode int, body payload, start time.Time) {
+	if c.metrics != nil {
+		c.metrics.ObservePush(statusCode, len(body.data), time.Since(start))
+	}
 }
@@ -8,12 +8,14 @@ import (
 	"io"
 	"net/http"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	stderrors "errors"
 
 	clouderrors "github.com/mwazovzky/cloudlog/errors"
+	"github.com/mwazovzky/cloudlog/metrics"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
@@ -519,3 +521,58 @@ func TestSendError(t *testing.T) {
 	assert.True(t, stderrors.Is(err, clouderrors.ErrConnectionFailed), "Expected a connection error")
 	assert.Contains(t, err.Error(), "connection to log service failed", "Expected connection failed error message")
 }
+
+func TestLokiClient_Send_Tenant(t *testing.T) {
+	var orgIDs []string
+	mockHTTPClient := new(MockHTTPClient)
+	mockHTTPClient.On("Do", mock.Anything).Run(func(args mock.Arguments) {
+		orgIDs = append(orgIDs, args.Get(0).(*http.Request).Header.Get("X-Scope-OrgID"))
+	}).Return(&http.Response{StatusCode: http.StatusNoContent, Body: http.NoBody}, nil)
+
+	entry := LokiEntry{
+		Streams: []LokiStream{
+			{
+				Stream: map[string]string{"job": "test-job"},
+				Values: [][]string{{"1626882892000000000", `{"message":"test log"}`}},
+			},
+		},
+	}
+
+	plain := NewLokiClient("http://mock-loki-url", "user", "token", mockHTTPClient)
+	require.NoError(t, plain.Send(context.Background(), entry))
+
+	tenanted := NewLokiClient("http://mock-loki-url", "user", "token", mockHTTPClient, WithTenant("default-tenant"))
+	require.NoError(t, tenanted.Send(context.Background(), entry))
+
+	entry.Tenant = "team-a"
+	require.NoError(t, tenanted.Send(context.Background(), entry))
+
+	assert.Equal(t, []string{"", "default-tenant", "team-a"}, orgIDs)
+}
+
+func TestLokiClient_Metrics(t *testing.T) {
+	var calls atomic.Int32
+	server, _ := headerServer(t, func(*http.Request) int {
+		if calls.Add(1) == 1 {
+			return http.StatusServiceUnavailable
+		}
+		return http.StatusNoContent
+	})
+
+	registry := metrics.NewRegistry()
+	client := NewLokiClient(server.URL, "user", "token", server.Client(),
+		WithRetry(RetryPolicy{MaxAttempts: 2, BaseDelay: time.Millisecond}),
+		WithMetrics(registry),
+	)
+	require.NoError(t, client.Send(context.Background(), newTestEntry()))
+
+	unreachable := NewLokiClient("http://127.0.0.1:1", "", "", http.DefaultClient, WithMetrics(registry))
+	require.Error(t, unreachable.Send(context.Background(), newTestEntry()))
+
+	var out strings.Builder
+	require.NoError(t, registry.Write(&out))
+	assert.Contains(t, out.String(), `cloudlog_push_requests_total{code="204"} 1`)
+	assert.Contains(t, out.String(), `cloudlog_push_requests_total{code="503"} 1`)
+	assert.Contains(t, out.String(), `cloudlog_push_requests_total{code="error"} 1`)
+	assert.Contains(t, out.String(), "cloudlog_push_duration_seconds_count 3")
+}
@@ -0,0 +1,55 @@
+package client
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"sync"
+)
+
+// defaultCompressionThreshold is the payload size below which bodies are sent uncompressed
+const defaultCompressionThreshold = 1024
+
+// gzipCompressor compresses payloads with pooled gzip writers
+type gzipCompressor struct {
+	level   int
+	writers sync.Pool
+}
+
+func newGzipCompressor(level int) *gzipCompressor {
+	if level < gzip.HuffmanOnly || level > gzip.BestCompression {
+		level = gzip.DefaultCompression
+	}
+
+	g := &gzipCompressor{level: level}
+	g.writers.New = func() interface{} {
+		// The level is validated above, so NewWriterLevel cannot fail
+		w, _ := gzip.NewWriterLevel(nil, g.level)
+		return w
+	}
+
+	return g
+}
+
+// compress returns the gzip-compressed form of data
+func (g *gzipCompressor) compress(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.Grow(len(data) / 4)
+
+	w := g.writers.Get().(*gzip.Writer)
+	defer func() {
+		// Detach the pooled writer from buf, so idle writers do not keep payloads alive
+		w.Reset(io.Discard)
+		g.writers.Put(w)
+	}()
+	w.Reset(&buf)
+
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,122 @@
+package client
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// capturingServer records the encoding and decoded body of each push
+type capturingServer struct {
+	mu        sync.Mutex
+	encodings []string
+	entries   []LokiEntry
+}
+
+func (s *capturingServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var reader io.Reader = r.Body
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		gz, err := gzip.NewReader(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		defer gz.Close()
+		reader = gz
+	}
+
+	var entry LokiEntry
+	if err := json.NewDecoder(reader).Decode(&entry); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	s.encodings = append(s.encodings, r.Header.Get("Content-Encoding"))
+	s.entries = append(s.entries, entry)
+	s.mu.Unlock()
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func largeEntry() LokiEntry {
+	entry := newTestEntry()
+	entry.Streams[0].Values[0][1] = strings.Repeat(`{"message":"repetitive payload"}`, 200)
+	return entry
+}
+
+func TestGzip_CompressesLargePayloads(t *testing.T) {
+	capture := &capturingServer{}
+	server := httptest.NewServer(capture)
+	defer server.Close()
+
+	client := NewLokiClient(server.URL, "user", "token", server.Client(), WithGzip(gzip.BestSpeed))
+
+	entry := largeEntry()
+	err := client.Send(context.Background(), entry)
+	require.NoError(t, err)
+
+	require.Len(t, capture.entries, 1)
+	assert.Equal(t, "gzip", capture.encodings[0])
+	assert.Equal(t, entry, capture.entries[0])
+}
+
+func TestGzip_SmallPayloadsSentRaw(t *testing.T) {
+	capture := &capturingServer{}
+	server := httptest.NewServer(capture)
+	defer server.Close()
+
+	client := NewLokiClient(server.URL, "user", "token", server.Client(),
+		WithGzip(gzip.DefaultCompression),
+		WithCompressionThreshold(64*1024),
+	)
+
+	err := client.Send(context.Background(), largeEntry())
+	require.NoError(t, err)
+
+	require.Len(t, capture.encodings, 1)
+	assert.Equal(t, "", capture.encodings[0])
+}
+
+func TestGzip_DisabledByDefault(t *testing.T) {
+	capture := &capturingServer{}
+	server := httptest.NewServer(capture)
+	defer server.Close()
+
+	client := NewLokiClient(server.URL, "user", "token", server.Client())
+
+	err := client.Send(context.Background(), largeEntry())
+	require.NoError(t, err)
+
+	require.Len(t, capture.encodings, 1)
+	assert.Equal(t, "", capture.encodings[0])
+}
+
+func TestGzip_ConcurrentSendsReuseWriters(t *testing.T) {
+	capture := &capturingServer{}
+	server := httptest.NewServer(capture)
+	defer server.Close()
+
+	client := NewLokiClient(server.URL, "user", "token", server.Client(), WithGzip(42))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, client.Send(context.Background(), largeEntry()))
+		}()
+	}
+	wg.Wait()
+
+	assert.Len(t, capture.entries, 20)
+}
@@ -0,0 +1,133 @@
+package client
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Hand-written encoder for Loki's logproto.PushRequest, avoiding a dependency
+// on the protobuf runtime and generated Loki types:
+//
+//	message PushRequest   { repeated StreamAdapter streams = 1; }
+//	message StreamAdapter { string labels = 1; repeated EntryAdapter entries = 2; }
+//	message EntryAdapter  { google.protobuf.Timestamp timestamp = 1; string line = 2; }
+//	message Timestamp     { int64 seconds = 1; int32 nanos = 2; }
+
+const (
+	protoWireVarint = 0
+	protoWireBytes  = 2
+)
+
+// encodePushRequest converts a LokiEntry into a protobuf-encoded PushRequest
+func encodePushRequest(entry LokiEntry) ([]byte, error) {
+	var buf, stream, value []byte
+
+	for _, s := range entry.Streams {
+		stream = protoAppendString(stream[:0], 1, formatLabels(s.Stream))
+
+		for _, v := range s.Values {
+			if len(v) < 2 {
+				return nil, fmt.Errorf("stream value must contain a timestamp and a line")
+			}
+			ns, err := strconv.ParseInt(v[0], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid timestamp %q: %v", v[0], err)
+			}
+
+			value = protoAppendTimestamp(value[:0], 1, time.Unix(0, ns))
+			value = protoAppendString(value, 2, v[1])
+			stream = protoAppendBytes(stream, 2, value)
+		}
+
+		buf = protoAppendBytes(buf, 1, stream)
+	}
+
+	return buf, nil
+}
+
+// formatLabels renders a label set in Prometheus selector syntax, e.g. {app="x", job="y"}
+func formatLabels(labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, k := range keys {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(k)
+		b.WriteByte('=')
+		b.WriteString(strconv.Quote(labels[k]))
+	}
+	b.WriteByte('}')
+
+	return b.String()
+}
+
+// parseLabels parses a label set in Prometheus selector syntax, as produced by
+// formatLabels and echoed back by Loki in error messages
+func parseLabels(s string) (map[string]string, error) {
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(s, "{") || !strings.HasSuffix(s, "}") {
+		return nil, fmt.Errorf("invalid label set %q", s)
+	}
+	s = strings.TrimSpace(s[1 : len(s)-1])
+
+	labels := make(map[string]string)
+	for s != "" {
+		eq := strings.IndexByte(s, '=')
+		if eq <= 0 {
+			return nil, fmt.Errorf("invalid label pair in %q", s)
+		}
+		key := strings.TrimSpace(s[:eq])
+
+		quoted, err := strconv.QuotedPrefix(strings.TrimLeft(s[eq+1:], " "))
+		if err != nil {
+			return nil, fmt.Errorf("invalid label value for %q: %v", key, err)
+		}
+		value, _ := strconv.Unquote(quoted)
+		labels[key] = value
+
+		s = strings.TrimLeft(s[eq+1:], " ")[len(quoted):]
+		s = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(s), ","))
+	}
+
+	return labels, nil
+}
+
+func protoAppendTag(b []byte, field int, wireType int) []byte {
+	return binary.AppendUvarint(b, uint64(field)<<3|uint64(wireType))
+}
+
+func protoAppendBytes(b []byte, field int, data []byte) []byte {
+	b = protoAppendTag(b, field, protoWireBytes)
+	b = binary.AppendUvarint(b, uint64(len(data)))
+	return append(b, data...)
+}
+
+func protoAppendString(b []byte, field int, s string) []byte {
+	b = protoAppendTag(b, field, protoWireBytes)
+	b = binary.AppendUvarint(b, uint64(len(s)))
+	return append(b, s...)
+}
+
+func protoAppendTimestamp(b []byte, field int, t time.Time) []byte {
+	var ts []byte
+	if seconds := t.Unix(); seconds != 0 {
+		ts = protoAppendTag(ts, 1, protoWireVarint)
+		ts = binary.AppendUvarint(ts, uint64(seconds))
+	}
+	if nanos := t.Nanosecond(); nanos != 0 {
+		ts = protoAppendTag(ts, 2, protoWireVarint)
+		ts = binary.AppendUvarint(ts, uint64(nanos))
+	}
+	return protoAppendBytes(b, field, ts)
+}
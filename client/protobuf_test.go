@@ -0,0 +1,244 @@
+package client
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// snappyDecode is a reference decoder for the snappy block format
+func snappyDecode(src []byte) ([]byte, error) {
+	n, k := binary.Uvarint(src)
+	if k <= 0 {
+		return nil, fmt.Errorf("invalid length preamble")
+	}
+	src = src[k:]
+	dst := make([]byte, 0, n)
+
+	for len(src) > 0 {
+		tag := src[0]
+		switch tag & 0x03 {
+		case snappyTagLiteral:
+			length := int(tag >> 2)
+			src = src[1:]
+			if length >= 60 {
+				extra := length - 59
+				length = 0
+				for i := 0; i < extra; i++ {
+					length |= int(src[i]) << (8 * i)
+				}
+				src = src[extra:]
+			}
+			length++
+			if length > len(src) {
+				return nil, fmt.Errorf("literal overruns input")
+			}
+			dst = append(dst, src[:length]...)
+			src = src[length:]
+			continue
+		case snappyTagCopy1:
+			length := int(tag>>2&0x07) + 4
+			offset := int(tag>>5)<<8 | int(src[1])
+			src = src[2:]
+			dst = snappyCopy(dst, offset, length)
+		case snappyTagCopy2:
+			length := int(tag>>2) + 1
+			offset := int(binary.LittleEndian.Uint16(src[1:]))
+			src = src[3:]
+			dst = snappyCopy(dst, offset, length)
+		default:
+			return nil, fmt.Errorf("unsupported tag %x", tag)
+		}
+		if dst == nil {
+			return nil, fmt.Errorf("invalid copy offset")
+		}
+	}
+
+	if uint64(len(dst)) != n {
+		return nil, fmt.Errorf("decoded %d bytes, expected %d", len(dst), n)
+	}
+	return dst, nil
+}
+
+func snappyCopy(dst []byte, offset, length int) []byte {
+	if offset <= 0 || offset > len(dst) {
+		return nil
+	}
+	for i := 0; i < length; i++ {
+		dst = append(dst, dst[len(dst)-offset])
+	}
+	return dst
+}
+
+// protoFields splits a protobuf message into its length-delimited and varint fields
+func protoFields(b []byte) (map[int][][]byte, map[int]uint64, error) {
+	bytesFields := make(map[int][][]byte)
+	varintFields := make(map[int]uint64)
+	for len(b) > 0 {
+		key, k := binary.Uvarint(b)
+		if k <= 0 {
+			return nil, nil, fmt.Errorf("invalid field key")
+		}
+		b = b[k:]
+		field := int(key >> 3)
+		value, k := binary.Uvarint(b)
+		if k <= 0 {
+			return nil, nil, fmt.Errorf("invalid varint")
+		}
+		b = b[k:]
+		switch key & 0x07 {
+		case protoWireVarint:
+			varintFields[field] = value
+		case protoWireBytes:
+			bytesFields[field] = append(bytesFields[field], b[:value])
+			b = b[value:]
+		default:
+			return nil, nil, fmt.Errorf("unsupported wire type %d", key&0x07)
+		}
+	}
+	return bytesFields, varintFields, nil
+}
+
+// decodePushRequest converts a snappy-compressed PushRequest back into a LokiEntry
+func decodePushRequest(body []byte) (LokiEntry, error) {
+	raw, err := snappyDecode(body)
+	if err != nil {
+		return LokiEntry{}, err
+	}
+	request, _, err := protoFields(raw)
+	if err != nil {
+		return LokiEntry{}, err
+	}
+
+	var entry LokiEntry
+	for _, streamData := range request[1] {
+		streamFields, _, err := protoFields(streamData)
+		if err != nil {
+			return LokiEntry{}, err
+		}
+		labels, err := parseLabels(string(streamFields[1][0]))
+		if err != nil {
+			return LokiEntry{}, err
+		}
+		stream := LokiStream{Stream: labels}
+		for _, entryData := range streamFields[2] {
+			entryFields, _, err := protoFields(entryData)
+			if err != nil {
+				return LokiEntry{}, err
+			}
+			_, ts, err := protoFields(entryFields[1][0])
+			if err != nil {
+				return LokiEntry{}, err
+			}
+			ns := time.Unix(int64(ts[1]), int64(ts[2])).UnixNano()
+			stream.Values = append(stream.Values, []string{strconv.FormatInt(ns, 10), string(entryFields[2][0])})
+		}
+		entry.Streams = append(entry.Streams, stream)
+	}
+	return entry, nil
+}
+
+func TestSnappyEncode_RoundTrip(t *testing.T) {
+	random := make([]byte, 100_000)
+	for i := range random {
+		random[i] = byte(rand.IntN(256))
+	}
+
+	inputs := map[string][]byte{
+		"empty":      {},
+		"short":      []byte("hello"),
+		"repetitive": []byte(strings.Repeat(`{"level":"info","message":"request handled"}`, 5000)),
+		"runs":       []byte(strings.Repeat("a", 1000) + strings.Repeat("ab", 1000)),
+		"random":     random,
+	}
+
+	for name, input := range inputs {
+		t.Run(name, func(t *testing.T) {
+			encoded := snappyEncode(input)
+			decoded, err := snappyDecode(encoded)
+			require.NoError(t, err)
+			assert.Equal(t, len(input), len(decoded))
+			assert.True(t, string(input) == string(decoded), "decoded payload differs from input")
+		})
+	}
+
+	repetitive := inputs["repetitive"]
+	assert.Less(t, len(snappyEncode(repetitive)), len(repetitive)/10)
+}
+
+func TestFormatLabels(t *testing.T) {
+	labels := map[string]string{"job": "api", "env": `pro"d`}
+	assert.Equal(t, `{env="pro\"d", job="api"}`, formatLabels(labels))
+}
+
+func TestProtobufEncoding_StandInServer(t *testing.T) {
+	var received LokiEntry
+	var contentType, contentEncoding string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contentType = r.Header.Get("Content-Type")
+		contentEncoding = r.Header.Get("Content-Encoding")
+		body, _ := io.ReadAll(r.Body)
+
+		var err error
+		received, err = decodePushRequest(body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	client := NewLokiClient(server.URL, "user", "token", server.Client(),
+		WithEncoding(EncodingProtobuf),
+		WithGzip(1),
+		WithCompressionThreshold(0),
+	)
+
+	entry := LokiEntry{
+		Streams: []LokiStream{
+			{
+				Stream: map[string]string{"job": "svc-a", "user_id": "1"},
+				Values: [][]string{
+					{"1626882892000000000", `{"message":"first"}`},
+					{"1626882892000000123", `{"message":"second"}`},
+				},
+			},
+			{
+				Stream: map[string]string{"job": "svc-b"},
+				Values: [][]string{
+					{"1626882893500000000", strings.Repeat("x", 5000)},
+				},
+			},
+		},
+	}
+
+	err := client.Send(context.Background(), entry)
+	require.NoError(t, err)
+
+	assert.Equal(t, "application/x-protobuf", contentType)
+	assert.Equal(t, "", contentEncoding)
+	assert.Equal(t, entry, received)
+}
+
+func TestProtobufEncoding_InvalidTimestamp(t *testing.T) {
+	client := NewLokiClient("http://mock-loki-url", "user", "token", new(MockHTTPClient), WithEncoding(EncodingProtobuf))
+
+	entry := newTestEntry()
+	entry.Streams[0].Values[0][0] = "not-a-number"
+
+	err := client.Send(context.Background(), entry)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid timestamp")
+}
@@ -0,0 +1,89 @@
+package client
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mwazovzky/cloudlog/errors"
+)
+
+// Loki reports partially rejected pushes as HTTP 400 with one message per
+// rejected entry, separated by newlines, for example:
+//
+//	entry with timestamp 2024-01-02 10:00:00 +0000 UTC ignored, reason: 'entry out of order' for stream: {job="api"},
+//	entry for stream '{job="api"}' has timestamp too new: 2024-01-02 10:00:00 +0000 UTC
+//	Max entry size '1024' bytes exceeded for stream '{job="api"}' while adding an entry with length '4096' bytes
+//	total ignored: 1 out of 3
+
+var (
+	rejectionStreamPattern    = regexp.MustCompile(`stream(?::\s*|\s+')(\{.*?\})(?:'|,|\s|$)`)
+	rejectionTimestampPattern = regexp.MustCompile(`timestamp (?:too (?:new|old): )?(\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2}(?:\.\d+)? [+-]\d{4} [A-Za-z0-9+-]+)`)
+	rejectionLineSizePattern  = regexp.MustCompile(`entry with length '(\d+)'`)
+)
+
+// lokiTimeLayout is time.Time.String's layout, which Loki uses in its messages
+const lokiTimeLayout = "2006-01-02 15:04:05.999999999 -0700 MST"
+
+// parseRejections extracts per-stream rejections from a Loki error response body.
+// Lines that are not recognised as rejections are ignored.
+func parseRejections(body string) []errors.Rejection {
+	var rejections []errors.Rejection
+
+	for _, line := range strings.Split(body, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		rejection := errors.Rejection{
+			Reason:  rejectionReason(line),
+			Message: line,
+		}
+
+		if m := rejectionStreamPattern.FindStringSubmatch(line); m != nil {
+			if labels, err := parseLabels(m[1]); err == nil {
+				rejection.Stream = labels
+			}
+		}
+		if m := rejectionTimestampPattern.FindStringSubmatch(line); m != nil {
+			if ts, err := time.Parse(lokiTimeLayout, m[1]); err == nil {
+				rejection.Timestamp = ts
+			}
+		}
+		if m := rejectionLineSizePattern.FindStringSubmatch(line); m != nil {
+			rejection.LineSize, _ = strconv.Atoi(m[1])
+		}
+
+		if rejection.Stream == nil && rejection.Reason == errors.ReasonUnknown {
+			continue
+		}
+		rejections = append(rejections, rejection)
+	}
+
+	return rejections
+}
+
+// rejectionReason classifies a Loki rejection message
+func rejectionReason(message string) string {
+	lower := strings.ToLower(message)
+	switch {
+	case strings.Contains(lower, "out of order"):
+		return errors.ReasonOutOfOrder
+	case strings.Contains(lower, "too far behind"), strings.Contains(lower, "too old"):
+		return errors.ReasonTooOld
+	case strings.Contains(lower, "too new"):
+		return errors.ReasonTooNew
+	case strings.Contains(lower, "entry size"), strings.Contains(lower, "line too long"):
+		return errors.ReasonLineTooLong
+	case strings.Contains(lower, "stream limit"):
+		return errors.ReasonStreamLimit
+	case strings.Contains(lower, "rate limit"):
+		return errors.ReasonRateLimited
+	case strings.Contains(lower, "label"):
+		return errors.ReasonInvalidLabels
+	default:
+		return errors.ReasonUnknown
+	}
+}
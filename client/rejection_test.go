@@ -0,0 +1,72 @@
+package client
+
+import (
+	"context"
+	stderrors "errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	clouderrors "github.com/mwazovzky/cloudlog/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const partialRejectionBody = `entry with timestamp 2024-01-02 10:00:00.5 +0000 UTC ignored, reason: 'entry out of order' for stream: {job="api", user_id="1"},
+entry for stream '{job="worker"}' has timestamp too new: 2024-01-02 11:00:00 +0000 UTC
+entry for stream '{job="worker"}' has timestamp too old: 2023-01-01 00:00:00 +0000 UTC, oldest acceptable timestamp is: 2023-12-26 00:00:00 +0000 UTC
+Max entry size '1024' bytes exceeded for stream '{job="batch"}' while adding an entry with length '4096' bytes
+Maximum active stream limit exceeded, reduce the number of active streams (reduce labels or reduce label values), or contact your Loki administrator to see if the limit can be increased, user: 'fake'
+total ignored: 5 out of 10`
+
+func TestParseRejections(t *testing.T) {
+	rejections := parseRejections(partialRejectionBody)
+	require.Len(t, rejections, 5)
+
+	assert.Equal(t, clouderrors.ReasonOutOfOrder, rejections[0].Reason)
+	assert.Equal(t, map[string]string{"job": "api", "user_id": "1"}, rejections[0].Stream)
+	assert.True(t, rejections[0].Timestamp.Equal(time.Date(2024, 1, 2, 10, 0, 0, 500_000_000, time.UTC)))
+
+	assert.Equal(t, clouderrors.ReasonTooNew, rejections[1].Reason)
+	assert.Equal(t, map[string]string{"job": "worker"}, rejections[1].Stream)
+	assert.True(t, rejections[1].Timestamp.Equal(time.Date(2024, 1, 2, 11, 0, 0, 0, time.UTC)))
+
+	assert.Equal(t, clouderrors.ReasonTooOld, rejections[2].Reason)
+	assert.True(t, rejections[2].Timestamp.Equal(time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)))
+
+	assert.Equal(t, clouderrors.ReasonLineTooLong, rejections[3].Reason)
+	assert.Equal(t, map[string]string{"job": "batch"}, rejections[3].Stream)
+	assert.Equal(t, 4096, rejections[3].LineSize)
+
+	assert.Equal(t, clouderrors.ReasonStreamLimit, rejections[4].Reason)
+	assert.Nil(t, rejections[4].Stream)
+}
+
+func TestParseLabels(t *testing.T) {
+	labels, err := parseLabels(`{job="api", path="/a,b", quote="x\"y"}`)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"job": "api", "path": "/a,b", "quote": `x"y`}, labels)
+
+	labels, err = parseLabels(`{}`)
+	require.NoError(t, err)
+	assert.Empty(t, labels)
+
+	_, err = parseLabels(`job="api"`)
+	assert.Error(t, err)
+}
+
+func TestSend_PartialRejection(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		http.Error(w, partialRejectionBody, http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	client := NewLokiClient(server.URL, "", "", server.Client())
+	err := client.Send(context.Background(), newTestEntry())
+
+	var sendErr *clouderrors.SendError
+	require.True(t, stderrors.As(err, &sendErr))
+	assert.False(t, sendErr.Retryable)
+	assert.Len(t, sendErr.Rejections, 5)
+}
@@ -0,0 +1,100 @@
+package client
+
+import (
+	"context"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy configures how LokiClient retries failed pushes
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, including the first one.
+	// Values below 2 disable retries.
+	MaxAttempts int
+	// BaseDelay is the delay before the first retry; it doubles on each subsequent retry
+	BaseDelay time.Duration
+	// MaxDelay caps the delay between two attempts
+	MaxDelay time.Duration
+	// Jitter is the fraction (0..1) of each delay that is randomised
+	Jitter float64
+}
+
+// DefaultRetryPolicy returns a retry policy suitable for most Loki deployments
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts: 5,
+		BaseDelay:   500 * time.Millisecond,
+		MaxDelay:    30 * time.Second,
+		Jitter:      0.2,
+	}
+}
+
+// Backoff returns the delay to wait after the given (1-based) failed attempt
+func (p RetryPolicy) Backoff(attempt int) time.Duration {
+	delay := p.BaseDelay
+	for i := 1; i < attempt && (p.MaxDelay <= 0 || delay < p.MaxDelay); i++ {
+		delay *= 2
+	}
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+
+	jitter := p.Jitter
+	if jitter > 1 {
+		jitter = 1
+	}
+	if jitter > 0 && delay > 0 {
+		// Spread the delay uniformly over [delay*(1-jitter), delay]
+		spread := time.Duration(float64(delay) * jitter)
+		delay -= time.Duration(rand.Int64N(int64(spread) + 1))
+	}
+
+	return delay
+}
+
+// isRetryableStatus reports whether an HTTP status from Loki is worth retrying.
+// Rate limiting and server-side failures are transient; other 4xx responses
+// mean the payload itself was rejected and will fail again.
+func isRetryableStatus(code int) bool {
+	return code == http.StatusTooManyRequests || code >= 500
+}
+
+// parseRetryAfter parses a Retry-After header given either as delay-seconds
+// or as an HTTP date. It returns zero when the header is absent or invalid.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		if d := date.Sub(now); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+// wait sleeps for the given delay, returning false if the context is done first
+// or its deadline would expire before the delay elapses.
+func wait(ctx context.Context, delay time.Duration) bool {
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+		return false
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,207 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	stderrors "errors"
+
+	clouderrors "github.com/mwazovzky/cloudlog/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestEntry() LokiEntry {
+	return LokiEntry{
+		Streams: []LokiStream{
+			{
+				Stream: map[string]string{"job": "test-job"},
+				Values: [][]string{
+					{fmt.Sprintf("%d", time.Now().UnixNano()), `{"message":"test log"}`},
+				},
+			},
+		},
+	}
+}
+
+func statusResponse(code int) *http.Response {
+	return &http.Response{
+		StatusCode: code,
+		Body:       io.NopCloser(bytes.NewBufferString(http.StatusText(code))),
+	}
+}
+
+// statusHTTPClient answers every request with the same status code
+type statusHTTPClient struct {
+	code  int
+	calls int
+}
+
+func (c *statusHTTPClient) Do(_ *http.Request) (*http.Response, error) {
+	c.calls++
+	return statusResponse(c.code), nil
+}
+
+var fastRetry = RetryPolicy{
+	MaxAttempts: 3,
+	BaseDelay:   time.Millisecond,
+	MaxDelay:    5 * time.Millisecond,
+}
+
+func TestRetry_SucceedsAfterTransientFailures(t *testing.T) {
+	mockHTTPClient := new(MockHTTPClient)
+	mockHTTPClient.On("Do", mock.Anything).Return(statusResponse(http.StatusServiceUnavailable), nil).Once()
+	mockHTTPClient.On("Do", mock.Anything).Return(nil, fmt.Errorf("connection reset")).Once()
+	mockHTTPClient.On("Do", mock.Anything).Return(statusResponse(http.StatusNoContent), nil).Once()
+
+	client := NewLokiClient("http://mock-loki-url", "user", "token", mockHTTPClient, WithRetry(fastRetry))
+
+	err := client.Send(context.Background(), newTestEntry())
+	assert.NoError(t, err)
+	mockHTTPClient.AssertNumberOfCalls(t, "Do", 3)
+}
+
+func TestRetry_GivesUpAfterMaxAttempts(t *testing.T) {
+	httpClient := &statusHTTPClient{code: http.StatusTooManyRequests}
+	client := NewLokiClient("http://mock-loki-url", "user", "token", httpClient, WithRetry(fastRetry))
+
+	err := client.Send(context.Background(), newTestEntry())
+	assert.True(t, clouderrors.IsResponseError(err))
+	assert.Equal(t, 3, httpClient.calls)
+}
+
+func TestRetry_DoesNotRetryClientErrors(t *testing.T) {
+	httpClient := &statusHTTPClient{code: http.StatusBadRequest}
+	client := NewLokiClient("http://mock-loki-url", "user", "token", httpClient, WithRetry(fastRetry))
+
+	err := client.Send(context.Background(), newTestEntry())
+	assert.True(t, clouderrors.IsResponseError(err))
+	assert.Equal(t, 1, httpClient.calls)
+}
+
+func TestRetry_DisabledByDefault(t *testing.T) {
+	httpClient := &statusHTTPClient{code: http.StatusInternalServerError}
+	client := NewLokiClient("http://mock-loki-url", "user", "token", httpClient)
+
+	err := client.Send(context.Background(), newTestEntry())
+	assert.Error(t, err)
+	assert.Equal(t, 1, httpClient.calls)
+}
+
+func TestRetry_HonoursContextDeadline(t *testing.T) {
+	httpClient := &statusHTTPClient{code: http.StatusBadGateway}
+	policy := RetryPolicy{MaxAttempts: 10, BaseDelay: time.Second, MaxDelay: time.Second}
+	client := NewLokiClient("http://mock-loki-url", "user", "token", httpClient, WithRetry(policy))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	err := client.Send(ctx, newTestEntry())
+	assert.True(t, clouderrors.IsResponseError(err))
+	assert.Less(t, time.Since(start), 500*time.Millisecond)
+	assert.Equal(t, 1, httpClient.calls)
+}
+
+func TestRetryPolicy_Backoff(t *testing.T) {
+	policy := RetryPolicy{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+
+	assert.Equal(t, 100*time.Millisecond, policy.Backoff(1))
+	assert.Equal(t, 200*time.Millisecond, policy.Backoff(2))
+	assert.Equal(t, 400*time.Millisecond, policy.Backoff(3))
+	assert.Equal(t, time.Second, policy.Backoff(10))
+
+	policy.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		d := policy.Backoff(2)
+		assert.GreaterOrEqual(t, d, 100*time.Millisecond)
+		assert.LessOrEqual(t, d, 200*time.Millisecond)
+	}
+}
+
+func TestSend_RateLimitedReturnsRetryAfter(t *testing.T) {
+	resp := statusResponse(http.StatusTooManyRequests)
+	resp.Header = http.Header{"Retry-After": []string{"7"}}
+
+	mockHTTPClient := new(MockHTTPClient)
+	mockHTTPClient.On("Do", mock.Anything).Return(resp, nil)
+
+	client := NewLokiClient("http://mock-loki-url", "user", "token", mockHTTPClient)
+
+	err := client.Send(context.Background(), newTestEntry())
+	assert.True(t, clouderrors.IsRateLimitError(err))
+	assert.True(t, clouderrors.IsResponseError(err))
+
+	delay, ok := clouderrors.RetryAfter(err)
+	assert.True(t, ok)
+	assert.Equal(t, 7*time.Second, delay)
+}
+
+func TestRetry_WaitsForRetryAfter(t *testing.T) {
+	resp := statusResponse(http.StatusTooManyRequests)
+	resp.Header = http.Header{"Retry-After": []string{"1"}}
+
+	mockHTTPClient := new(MockHTTPClient)
+	mockHTTPClient.On("Do", mock.Anything).Return(resp, nil).Once()
+	mockHTTPClient.On("Do", mock.Anything).Return(statusResponse(http.StatusNoContent), nil).Once()
+
+	client := NewLokiClient("http://mock-loki-url", "user", "token", mockHTTPClient, WithRetry(fastRetry))
+
+	start := time.Now()
+	err := client.Send(context.Background(), newTestEntry())
+	assert.NoError(t, err)
+	assert.GreaterOrEqual(t, time.Since(start), time.Second)
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	assert.Equal(t, time.Duration(0), parseRetryAfter("", now))
+	assert.Equal(t, 30*time.Second, parseRetryAfter("30", now))
+	assert.Equal(t, time.Duration(0), parseRetryAfter("-5", now))
+	assert.Equal(t, time.Duration(0), parseRetryAfter("soon", now))
+	assert.Equal(t, 90*time.Second, parseRetryAfter(now.Add(90*time.Second).Format(http.TimeFormat), now))
+	assert.Equal(t, time.Duration(0), parseRetryAfter(now.Add(-time.Minute).Format(http.TimeFormat), now))
+}
+
+func TestSend_ReturnsSendError(t *testing.T) {
+	httpClient := &statusHTTPClient{code: http.StatusServiceUnavailable}
+	client := NewLokiClient("http://mock-loki-url", "user", "token", httpClient, WithRetry(fastRetry))
+
+	entry := newTestEntry()
+	entry.Streams = append(entry.Streams, entry.Streams[0])
+
+	err := client.Send(context.Background(), entry)
+
+	var sendErr *clouderrors.SendError
+	require.True(t, stderrors.As(err, &sendErr))
+	assert.Equal(t, http.StatusServiceUnavailable, sendErr.StatusCode)
+	assert.Equal(t, "Service Unavailable", sendErr.Body)
+	assert.Equal(t, "http://mock-loki-url", sendErr.Endpoint)
+	assert.Equal(t, 3, sendErr.Attempts)
+	assert.True(t, sendErr.Retryable)
+	assert.Equal(t, 2, sendErr.Streams)
+	assert.True(t, clouderrors.IsResponseError(err))
+}
+
+func TestSend_ConnectionSendError(t *testing.T) {
+	mockHTTPClient := new(MockHTTPClient)
+	mockHTTPClient.On("Do", mock.Anything).Return(nil, fmt.Errorf("dial tcp: connection refused"))
+
+	client := NewLokiClient("http://mock-loki-url", "user", "token", mockHTTPClient)
+
+	err := client.Send(context.Background(), newTestEntry())
+
+	var sendErr *clouderrors.SendError
+	require.True(t, stderrors.As(err, &sendErr))
+	assert.Equal(t, 0, sendErr.StatusCode)
+	assert.Equal(t, 1, sendErr.Attempts)
+	assert.True(t, sendErr.Retryable)
+	assert.True(t, clouderrors.IsConnectionError(err))
+}
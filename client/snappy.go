@@ -0,0 +1,110 @@
+package client
+
+import (
+	"encoding/binary"
+)
+
+// Minimal encoder for the snappy block format, as expected by Loki's push API
+// for protobuf payloads. Input is split into 64KB blocks so that every copy
+// offset fits into the 2-byte form, matching the reference implementation.
+
+const (
+	snappyMaxBlockSize = 65536
+	snappyTableBits    = 14
+	snappyMinMatch     = 4
+
+	snappyTagLiteral = 0x00
+	snappyTagCopy1   = 0x01
+	snappyTagCopy2   = 0x02
+)
+
+// snappyEncode returns the snappy block encoding of src
+func snappyEncode(src []byte) []byte {
+	dst := make([]byte, 0, 32+len(src)+len(src)/6)
+	dst = binary.AppendUvarint(dst, uint64(len(src)))
+
+	for len(src) > 0 {
+		block := src
+		if len(block) > snappyMaxBlockSize {
+			block = block[:snappyMaxBlockSize]
+		}
+		src = src[len(block):]
+		dst = snappyEncodeBlock(dst, block)
+	}
+
+	return dst
+}
+
+// snappyEncodeBlock greedily replaces repeated 4-byte sequences with copies
+func snappyEncodeBlock(dst, src []byte) []byte {
+	if len(src) < snappyMinMatch*4 {
+		return snappyEmitLiteral(dst, src)
+	}
+
+	// table holds the last position+1 of each hashed 4-byte sequence
+	var table [1 << snappyTableBits]int32
+
+	literalStart := 0
+	for i := 0; i+snappyMinMatch <= len(src); {
+		cur := binary.LittleEndian.Uint32(src[i:])
+		h := (cur * 0x1e35a7bd) >> (32 - snappyTableBits)
+		candidate := int(table[h]) - 1
+		table[h] = int32(i + 1)
+
+		if candidate < 0 || binary.LittleEndian.Uint32(src[candidate:]) != cur {
+			i++
+			continue
+		}
+
+		length := snappyMinMatch
+		for i+length < len(src) && src[candidate+length] == src[i+length] {
+			length++
+		}
+
+		dst = snappyEmitLiteral(dst, src[literalStart:i])
+		dst = snappyEmitCopy(dst, i-candidate, length)
+		i += length
+		literalStart = i
+	}
+
+	return snappyEmitLiteral(dst, src[literalStart:])
+}
+
+func snappyEmitLiteral(dst, lit []byte) []byte {
+	if len(lit) == 0 {
+		return dst
+	}
+
+	n := uint32(len(lit) - 1)
+	switch {
+	case n < 60:
+		dst = append(dst, byte(n)<<2|snappyTagLiteral)
+	case n < 1<<8:
+		dst = append(dst, 60<<2|snappyTagLiteral, byte(n))
+	case n < 1<<16:
+		dst = append(dst, 61<<2|snappyTagLiteral, byte(n), byte(n>>8))
+	case n < 1<<24:
+		dst = append(dst, 62<<2|snappyTagLiteral, byte(n), byte(n>>8), byte(n>>16))
+	default:
+		dst = append(dst, 63<<2|snappyTagLiteral, byte(n), byte(n>>8), byte(n>>16), byte(n>>24))
+	}
+
+	return append(dst, lit...)
+}
+
+func snappyEmitCopy(dst []byte, offset, length int) []byte {
+	// Long matches are split so that the final copy is at least 4 bytes long
+	for length >= 68 {
+		dst = append(dst, 63<<2|snappyTagCopy2, byte(offset), byte(offset>>8))
+		length -= 64
+	}
+	if length > 64 {
+		dst = append(dst, 59<<2|snappyTagCopy2, byte(offset), byte(offset>>8))
+		length -= 60
+	}
+
+	if length >= 12 || offset >= 2048 {
+		return append(dst, byte(length-1)<<2|snappyTagCopy2, byte(offset), byte(offset>>8))
+	}
+	return append(dst, byte(offset>>8)<<5|byte(length-4)<<2|snappyTagCopy1, byte(offset))
+}
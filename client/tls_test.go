@@ -0,0 +1,385 @@
+package client
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	clouderrors "github.com/mwazovzky/cloudlog/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testCA issues certificates for TLS tests
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	return &testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue returns PEM-encoded certificate and key signed by the CA, valid for loki.test and 127.0.0.1
+func (ca *testCA) issue(t *testing.T, commonName string, usage x509.ExtKeyUsage) ([]byte, []byte) {
+	return ca.issueFor(t, commonName, usage, []string{"loki.test"}, []net.IP{net.ParseIP("127.0.0.1")})
+}
+
+// issueFor returns PEM-encoded certificate and key signed by the CA for the given names
+func (ca *testCA) issueFor(t *testing.T, commonName string, usage x509.ExtKeyUsage, dnsNames []string, ips []net.IP) ([]byte, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: commonName},
+		DNSNames:     dnsNames,
+		IPAddresses:  ips,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	require.NoError(t, err)
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+func writeFile(t *testing.T, path string, data []byte, modTime time.Time) {
+	require.NoError(t, os.WriteFile(path, data, 0o600))
+	require.NoError(t, os.Chtimes(path, modTime, modTime))
+}
+
+// newTLSServer starts a server presenting the given certificate, without client authentication
+func newTLSServer(t *testing.T, certPEM, keyPEM []byte) *httptest.Server {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	serverCert, err := tls.X509KeyPair(certPEM, keyPEM)
+	require.NoError(t, err)
+	server.TLS = &tls.Config{Certificates: []tls.Certificate{serverCert}}
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+// newMTLSServer starts a server that requires client certificates from ca
+// and records the common name of each client
+func newMTLSServer(t *testing.T, ca *testCA) (*httptest.Server, func() []string) {
+	var mu sync.Mutex
+	var clients []string
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		clients = append(clients, r.TLS.PeerCertificates[0].Subject.CommonName)
+		mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	certPEM, keyPEM := ca.issue(t, "loki", x509.ExtKeyUsageServerAuth)
+	serverCert, err := tls.X509KeyPair(certPEM, keyPEM)
+	require.NoError(t, err)
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+	server.TLS = &tls.Config{
+		Certificates: []tls.Certificate{serverCert},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    pool,
+	}
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	return server, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string{}, clients...)
+	}
+}
+
+func TestTLS_MutualAuthAndCertificateRotation(t *testing.T) {
+	ca := newTestCA(t)
+	server, clients := newMTLSServer(t, ca)
+
+	dir := t.TempDir()
+	caFile := filepath.Join(dir, "ca.pem")
+	certFile := filepath.Join(dir, "client.pem")
+	keyFile := filepath.Join(dir, "client-key.pem")
+
+	now := time.Now()
+	writeFile(t, caFile, ca.pem, now)
+	certPEM, keyPEM := ca.issue(t, "client-v1", x509.ExtKeyUsageClientAuth)
+	writeFile(t, certFile, certPEM, now)
+	writeFile(t, keyFile, keyPEM, now)
+
+	httpClient, err := NewTLSHTTPClient(TLSConfig{
+		CAFile:     caFile,
+		CertFile:   certFile,
+		KeyFile:    keyFile,
+		ServerName: "loki.test",
+	}, 5*time.Second)
+	require.NoError(t, err)
+
+	client := NewLokiClient(server.URL, "", "", httpClient)
+	require.NoError(t, client.Send(context.Background(), newTestEntry()))
+
+	// Rotate the client certificate on disk; new connections must use it
+	certPEM, keyPEM = ca.issue(t, "client-v2", x509.ExtKeyUsageClientAuth)
+	later := now.Add(time.Minute)
+	writeFile(t, certFile, certPEM, later)
+	writeFile(t, keyFile, keyPEM, later)
+	httpClient.CloseIdleConnections()
+
+	require.NoError(t, client.Send(context.Background(), newTestEntry()))
+	assert.Equal(t, []string{"client-v1", "client-v2"}, clients())
+}
+
+func TestTLS_RejectsUntrustedServer(t *testing.T) {
+	server, _ := newMTLSServer(t, newTestCA(t))
+
+	otherCA := newTestCA(t)
+	dir := t.TempDir()
+	caFile := filepath.Join(dir, "ca.pem")
+	writeFile(t, caFile, otherCA.pem, time.Now())
+
+	httpClient, err := NewTLSHTTPClient(TLSConfig{CAFile: caFile, ServerName: "loki.test"}, 5*time.Second)
+	require.NoError(t, err)
+
+	err = NewLokiClient(server.URL, "", "", httpClient).Send(context.Background(), newTestEntry())
+	assert.True(t, clouderrors.IsConnectionError(err))
+	assert.Contains(t, err.Error(), "certificate")
+}
+
+func TestTLS_RejectsWrongServerName(t *testing.T) {
+	ca := newTestCA(t)
+	server, _ := newMTLSServer(t, ca)
+
+	dir := t.TempDir()
+	caFile := filepath.Join(dir, "ca.pem")
+	writeFile(t, caFile, ca.pem, time.Now())
+
+	httpClient, err := NewTLSHTTPClient(TLSConfig{CAFile: caFile, ServerName: "other.test"}, 5*time.Second)
+	require.NoError(t, err)
+
+	err = NewLokiClient(server.URL, "", "", httpClient).Send(context.Background(), newTestEntry())
+	assert.True(t, clouderrors.IsConnectionError(err))
+}
+
+func TestTLS_VerifiesIPEndpointWithoutServerName(t *testing.T) {
+	ca := newTestCA(t)
+	dir := t.TempDir()
+	caFile := filepath.Join(dir, "ca.pem")
+	writeFile(t, caFile, ca.pem, time.Now())
+
+	httpClient, err := NewTLSHTTPClient(TLSConfig{CAFile: caFile}, 5*time.Second)
+	require.NoError(t, err)
+
+	// A certificate from the trusted CA that does not name the endpoint is rejected
+	certPEM, keyPEM := ca.issueFor(t, "evil", x509.ExtKeyUsageServerAuth, []string{"evil.example"}, nil)
+	server := newTLSServer(t, certPEM, keyPEM)
+
+	err = NewLokiClient(server.URL, "", "", httpClient).Send(context.Background(), newTestEntry())
+	assert.True(t, clouderrors.IsConnectionError(err))
+	assert.Contains(t, err.Error(), "127.0.0.1")
+
+	// One with a matching IP SAN is accepted
+	certPEM, keyPEM = ca.issue(t, "loki", x509.ExtKeyUsageServerAuth)
+	server = newTLSServer(t, certPEM, keyPEM)
+
+	assert.NoError(t, NewLokiClient(server.URL, "", "", httpClient).Send(context.Background(), newTestEntry()))
+}
+
+func TestTLS_CABundleRotation(t *testing.T) {
+	ca := newTestCA(t)
+	server, _ := newMTLSServer(t, ca)
+	certPEM, keyPEM := ca.issue(t, "client", x509.ExtKeyUsageClientAuth)
+
+	dir := t.TempDir()
+	caFile := filepath.Join(dir, "ca.pem")
+	certFile := filepath.Join(dir, "client.pem")
+	keyFile := filepath.Join(dir, "client-key.pem")
+
+	now := time.Now()
+	writeFile(t, caFile, newTestCA(t).pem, now)
+	writeFile(t, certFile, certPEM, now)
+	writeFile(t, keyFile, keyPEM, now)
+
+	httpClient, err := NewTLSHTTPClient(TLSConfig{CAFile: caFile, CertFile: certFile, KeyFile: keyFile}, 5*time.Second)
+	require.NoError(t, err)
+	client := NewLokiClient(server.URL, "", "", httpClient)
+
+	err = client.Send(context.Background(), newTestEntry())
+	assert.True(t, clouderrors.IsConnectionError(err))
+
+	// Replacing the CA bundle on disk lets new connections verify the server
+	writeFile(t, caFile, ca.pem, now.Add(time.Minute))
+	assert.NoError(t, client.Send(context.Background(), newTestEntry()))
+}
+
+// newConnectProxy starts an HTTP proxy that tunnels CONNECT requests and counts them
+func newConnectProxy(t *testing.T) (*url.URL, *atomic.Int32) {
+	var tunnels atomic.Int32
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodConnect {
+			http.Error(w, "CONNECT only", http.StatusMethodNotAllowed)
+			return
+		}
+		upstream, err := net.Dial("tcp", r.Host)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		tunnels.Add(1)
+		w.WriteHeader(http.StatusOK)
+		conn, _, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			upstream.Close()
+			return
+		}
+		go func() {
+			_, _ = io.Copy(upstream, conn)
+			upstream.Close()
+		}()
+		go func() {
+			_, _ = io.Copy(conn, upstream)
+			conn.Close()
+		}()
+	}))
+	t.Cleanup(proxy.Close)
+
+	proxyURL, err := url.Parse(proxy.URL)
+	require.NoError(t, err)
+	return proxyURL, &tunnels
+}
+
+func TestTLS_CABundleRotationThroughProxy(t *testing.T) {
+	ca := newTestCA(t)
+	server, _ := newMTLSServer(t, ca)
+	proxyURL, tunnels := newConnectProxy(t)
+	certPEM, keyPEM := ca.issue(t, "client", x509.ExtKeyUsageClientAuth)
+
+	dir := t.TempDir()
+	caFile := filepath.Join(dir, "ca.pem")
+	certFile := filepath.Join(dir, "client.pem")
+	keyFile := filepath.Join(dir, "client-key.pem")
+
+	now := time.Now()
+	writeFile(t, caFile, newTestCA(t).pem, now)
+	writeFile(t, certFile, certPEM, now)
+	writeFile(t, keyFile, keyPEM, now)
+
+	newClient := func(serverName string) *LokiClient {
+		httpClient, err := NewTLSHTTPClient(TLSConfig{
+			CAFile:     caFile,
+			CertFile:   certFile,
+			KeyFile:    keyFile,
+			ServerName: serverName,
+		}, 5*time.Second)
+		require.NoError(t, err)
+		httpClient.Transport.(*http.Transport).Proxy = http.ProxyURL(proxyURL)
+		return NewLokiClient(server.URL, "", "", httpClient)
+	}
+	client := newClient("loki.test")
+
+	err := client.Send(context.Background(), newTestEntry())
+	assert.True(t, clouderrors.IsConnectionError(err))
+
+	// The proxied handshake sees the CA bundle replaced on disk
+	writeFile(t, caFile, ca.pem, now.Add(time.Minute))
+	assert.NoError(t, client.Send(context.Background(), newTestEntry()))
+	assert.Equal(t, int32(2), tunnels.Load())
+
+	// Without ServerName the host name of an IP endpoint cannot be checked, so it is rejected
+	err = newClient("").Send(context.Background(), newTestEntry())
+	assert.True(t, clouderrors.IsConnectionError(err))
+	assert.Contains(t, err.Error(), "ServerName")
+}
+
+func TestTLS_HandshakeTimeout(t *testing.T) {
+	// The server accepts connections but never answers the handshake
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			t.Cleanup(func() { conn.Close() })
+		}
+	}()
+
+	dir := t.TempDir()
+	caFile := filepath.Join(dir, "ca.pem")
+	writeFile(t, caFile, newTestCA(t).pem, time.Now())
+
+	httpClient, err := NewTLSHTTPClient(TLSConfig{CAFile: caFile}, 10*time.Second)
+	require.NoError(t, err)
+	httpClient.Transport.(*http.Transport).TLSHandshakeTimeout = 50 * time.Millisecond
+
+	start := time.Now()
+	err = NewLokiClient("https://"+listener.Addr().String(), "", "", httpClient).Send(context.Background(), newTestEntry())
+	assert.True(t, clouderrors.IsConnectionError(err))
+	assert.Less(t, time.Since(start), 5*time.Second)
+}
+
+func TestTLSConfig_BuildErrors(t *testing.T) {
+	dir := t.TempDir()
+
+	_, err := TLSConfig{CertFile: filepath.Join(dir, "cert.pem")}.Build()
+	assert.ErrorIs(t, err, clouderrors.ErrInvalidInput)
+
+	_, err = TLSConfig{CAFile: filepath.Join(dir, "missing.pem")}.Build()
+	assert.ErrorIs(t, err, clouderrors.ErrInvalidInput)
+
+	cfg, err := TLSConfig{}.Build()
+	require.NoError(t, err)
+	assert.Equal(t, uint16(tls.VersionTLS12), cfg.MinVersion)
+	assert.False(t, cfg.InsecureSkipVerify)
+}
@@ -2,10 +2,17 @@
 package cloudlog
 
 import (
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+
 	"github.com/mwazovzky/cloudlog/client"
 	"github.com/mwazovzky/cloudlog/errors"
 	"github.com/mwazovzky/cloudlog/formatter"
 	"github.com/mwazovzky/cloudlog/logger"
+	"github.com/mwazovzky/cloudlog/metrics"
+	"github.com/mwazovzky/cloudlog/middleware"
 )
 
 // Error type check functions
@@ -13,6 +20,8 @@ var (
 	IsFormatError     = errors.IsFormatError
 	IsConnectionError = errors.IsConnectionError
 	IsResponseError   = errors.IsResponseError
+	IsRateLimitError  = errors.IsRateLimitError
+	RetryAfter        = errors.RetryAfter
 )
 
 // Log level constants
@@ -23,13 +32,78 @@ const (
 	LevelError = logger.LevelError
 )
 
+// Push encodings
+const (
+	EncodingJSON     = client.EncodingJSON
+	EncodingProtobuf = client.EncodingProtobuf
+)
+
+// Line size policies
+const (
+	LineTruncate = logger.LineTruncate
+	LineDrop     = logger.LineDrop
+)
+
+// Spool fsync policies
+const (
+	SpoolSyncInterval = logger.SpoolSyncInterval
+	SpoolSyncAlways   = logger.SpoolSyncAlways
+	SpoolSyncNever    = logger.SpoolSyncNever
+)
+
+// Buffer overflow policies
+const (
+	OverflowReject       = logger.OverflowReject
+	OverflowBlock        = logger.OverflowBlock
+	OverflowBlockTimeout = logger.OverflowBlockTimeout
+	OverflowDropOldest   = logger.OverflowDropOldest
+	OverflowSample       = logger.OverflowSample
+)
+
+// Retry queue overflow policies
+const (
+	RetryDropOldest = logger.RetryDropOldest
+	RetryDropNewest = logger.RetryDropNewest
+)
+
 // Type re-exports
 type (
-	Logger            = logger.Logger
-	Sender            = logger.Sender
-	HTTPClient        = client.HTTPClient
-	Option            = logger.Option
-	AsyncSenderOption = logger.AsyncSenderOption
+	Logger              = logger.Logger
+	Sender              = logger.Sender
+	HTTPClient          = client.HTTPClient
+	Option              = logger.Option
+	AsyncSenderOption   = logger.AsyncSenderOption
+	LinePolicy          = logger.LinePolicy
+	SpoolConfig         = logger.SpoolConfig
+	RetryQueueConfig    = logger.RetryQueueConfig
+	RetryOverflow       = logger.RetryOverflow
+	OverflowConfig      = logger.OverflowConfig
+	OverflowPolicy      = logger.OverflowPolicy
+	OverflowStats       = logger.OverflowStats
+	AdaptiveBatchConfig = logger.AdaptiveBatchConfig
+	SlogHandler         = logger.SlogHandler
+	ContextExtractor    = logger.ContextExtractor
+	TraceContext        = logger.TraceContext
+	Stats               = logger.Stats
+	LatencyHistogram    = logger.LatencyHistogram
+	LatencyBucket       = logger.LatencyBucket
+	Metrics             = metrics.Registry
+	ClientOption        = client.LokiClientOption
+	RetryPolicy         = client.RetryPolicy
+	Encoding            = client.Encoding
+	Authenticator       = client.Authenticator
+	BasicAuth           = client.BasicAuth
+	BearerToken         = client.BearerToken
+	StaticHeader        = client.StaticHeader
+	TLSConfig           = client.TLSConfig
+	SendError           = errors.SendError
+	RateLimitError      = errors.RateLimitError
+	Rejection           = errors.Rejection
+	RejectedEntry       = errors.RejectedEntry
+	DroppedError        = errors.DroppedError
+	UndeliveredError    = errors.UndeliveredError
+
+	RejectedEntriesError = errors.RejectedEntriesError
 )
 
 // New creates a new Logger with the given sender and options
@@ -37,6 +111,22 @@ func New(sender logger.Sender, options ...logger.Option) logger.Logger {
 	return logger.New(sender, options...)
 }
 
+// NewSlogHandler creates a log/slog Handler that sends records through sender,
+// configured with the same options as New
+func NewSlogHandler(sender logger.Sender, options ...logger.Option) *logger.SlogHandler {
+	return logger.NewSlogHandler(sender, options...)
+}
+
+// NewSlogLogger creates a Logger that writes to an slog.Handler
+func NewSlogLogger(handler slog.Handler) logger.Logger {
+	return logger.NewSlogLogger(handler)
+}
+
+// NewLoggerHandler creates an slog.Handler that writes to a Logger
+func NewLoggerHandler(l logger.Logger) slog.Handler {
+	return logger.NewLoggerHandler(l)
+}
+
 // NewSyncSender creates a sender that delivers log entries synchronously
 func NewSyncSender(c client.LogSender) *logger.SyncSender {
 	return logger.NewSyncSender(c)
@@ -49,19 +139,50 @@ func NewAsyncSender(c client.LogSender, options ...AsyncSenderOption) *logger.As
 
 // Async sender options
 var (
-	WithBufferSize    = logger.WithBufferSize
-	WithBatchSize     = logger.WithBatchSize
-	WithFlushInterval = logger.WithFlushInterval
-	WithBlockOnFull   = logger.WithBlockOnFull
-	WithErrorHandler  = logger.WithErrorHandler
-	WithSendTimeout   = logger.WithSendTimeout
+	WithBufferSize       = logger.WithBufferSize
+	WithBatchSize        = logger.WithBatchSize
+	WithFlushInterval    = logger.WithFlushInterval
+	WithBlockOnFull      = logger.WithBlockOnFull
+	WithErrorHandler     = logger.WithErrorHandler
+	WithSendTimeout      = logger.WithSendTimeout
+	WithMaxLineSize      = logger.WithMaxLineSize
+	WithMaxBatchBytes    = logger.WithMaxBatchBytes
+	WithMaxBufferBytes   = logger.WithMaxBufferBytes
+	WithSpool            = logger.WithSpool
+	WithRetryQueue       = logger.WithRetryQueue
+	WithOverflow         = logger.WithOverflow
+	WithPriorityLane     = logger.WithPriorityLane
+	WithWorkers          = logger.WithWorkers
+	WithFallback         = logger.WithFallback
+	WithSenderMetrics    = logger.WithSenderMetrics
+	WithAdaptiveBatching = logger.WithAdaptiveBatching
 )
 
-// NewClient creates a new Loki client with the given credentials
-func NewClient(url, username, token string, httpClient client.HTTPClient) client.LogSender {
-	return client.NewLokiClient(url, username, token, httpClient)
+// NewClient creates a new Loki client with the given credentials.
+// Empty username and token disable basic auth; use WithAuth for other schemes.
+func NewClient(url, username, token string, httpClient client.HTTPClient, options ...ClientOption) client.LogSender {
+	return client.NewLokiClient(url, username, token, httpClient, options...)
+}
+
+// NewTLSHTTPClient creates an HTTP client for Loki endpoints that require TLS or mTLS
+func NewTLSHTTPClient(cfg TLSConfig, timeout time.Duration) (*http.Client, error) {
+	return client.NewTLSHTTPClient(cfg, timeout)
 }
 
+// Client options
+var (
+	WithRetry          = client.WithRetry
+	DefaultRetryPolicy = client.DefaultRetryPolicy
+
+	WithAuth                 = client.WithAuth
+	NewRotatingToken         = client.NewRotatingToken
+	WithClientTenant         = client.WithTenant
+	WithEncoding             = client.WithEncoding
+	WithGzip                 = client.WithGzip
+	WithCompressionThreshold = client.WithCompressionThreshold
+	WithClientMetrics        = client.WithMetrics
+)
+
 // Logger options
 func WithFormatter(f formatter.Formatter) Option {
 	return logger.WithFormatter(f)
@@ -83,6 +204,70 @@ func WithMinLevel(level int) Option {
 	return logger.WithMinLevel(level)
 }
 
+func WithTenant(tenant string) Option {
+	return logger.WithTenant(tenant)
+}
+
+func WithMetrics(registry *Metrics) Option {
+	return logger.WithMetrics(registry)
+}
+
+// NewMetrics creates a metrics registry that serves Prometheus text format over HTTP
+func NewMetrics() *Metrics {
+	return metrics.NewRegistry()
+}
+
+// ContextWithTenant routes entries logged with the returned context to the given Loki tenant
+func ContextWithTenant(ctx context.Context, tenant string) context.Context {
+	return logger.ContextWithTenant(ctx, tenant)
+}
+
+// NewContext returns a context carrying the logger, for FromContext to retrieve
+func NewContext(ctx context.Context, l logger.Logger) context.Context {
+	return logger.NewContext(ctx, l)
+}
+
+// FromContext returns the logger stored by NewContext, or the default logger
+func FromContext(ctx context.Context) logger.Logger {
+	return logger.FromContext(ctx)
+}
+
+// ContextWith returns a context whose logger has the key-values added
+func ContextWith(ctx context.Context, keyvals ...interface{}) context.Context {
+	return logger.ContextWith(ctx, keyvals...)
+}
+
+// SetDefault sets the logger FromContext returns for contexts without one
+func SetDefault(l logger.Logger) {
+	logger.SetDefault(l)
+}
+
+// NewHTTPMiddleware returns net/http middleware that logs every request and
+// attaches a request-scoped logger to its context
+func NewHTTPMiddleware(l logger.Logger, options ...middleware.Option) func(http.Handler) http.Handler {
+	return middleware.New(l, options...)
+}
+
+// HTTP middleware options
+var (
+	WithRequestIDHeader    = middleware.WithRequestIDHeader
+	WithRequestIDGenerator = middleware.WithRequestIDGenerator
+)
+
+// Context correlation helpers
+var (
+	WithContextExtractor    = logger.WithContextExtractor
+	WithContextExtractors   = logger.WithContextExtractors
+	ContextWithTraceContext = logger.ContextWithTraceContext
+	TraceContextFromContext = logger.TraceContextFromContext
+	ParseTraceparent        = logger.ParseTraceparent
+	ContextWithRequestID    = logger.ContextWithRequestID
+	RequestIDFromContext    = logger.RequestIDFromContext
+	TraceExtractor          = logger.TraceExtractor
+	RequestIDExtractor      = logger.RequestIDExtractor
+	ContextValueExtractor   = logger.ContextValueExtractor
+)
+
 // Formatter constructors and options
 func NewLokiFormatter(options ...formatter.LokiFormatterOption) formatter.Formatter {
 	return formatter.NewLokiFormatter(options...)
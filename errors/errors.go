@@ -3,6 +3,8 @@ package errors
 
 import (
 	"errors"
+	"fmt"
+	"time"
 )
 
 // Common errors that can be used for comparison
@@ -16,16 +18,178 @@ var (
 	// ErrResponseError indicates an error response from the log service
 	ErrResponseError = errors.New("received error response from log service")
 
+	// ErrRateLimited indicates the log service rejected a request with HTTP 429
+	ErrRateLimited = errors.New("rate limited by log service")
+
 	// ErrInvalidInput indicates invalid input parameters
 	ErrInvalidInput = errors.New("invalid input parameters")
 
 	// ErrBufferFull indicates the async sender buffer is full
 	ErrBufferFull = errors.New("log buffer is full")
 
+	// ErrLineTooLong indicates a log line exceeded the configured maximum size
+	ErrLineTooLong = errors.New("log line too long")
+
+	// ErrSpoolFull indicates the async sender's disk spool reached its size cap
+	ErrSpoolFull = errors.New("log spool is full")
+
+	// ErrEntriesDropped indicates the async sender discarded entries it could not deliver
+	ErrEntriesDropped = errors.New("log entries dropped")
+
 	// ErrSenderClosed indicates the sender has been closed
 	ErrSenderClosed = errors.New("sender is closed")
 )
 
+// RateLimitError is returned when the log service responds with HTTP 429.
+// It matches both ErrRateLimited and ErrResponseError.
+type RateLimitError struct {
+	// RetryAfter is the delay requested by the Retry-After header, zero if absent
+	RetryAfter time.Duration
+	// Body is the response body returned by the log service
+	Body string
+}
+
+func (e *RateLimitError) Error() string {
+	if e.RetryAfter > 0 {
+		return fmt.Sprintf("%v: retry after %v: %s", ErrRateLimited, e.RetryAfter, e.Body)
+	}
+	return fmt.Sprintf("%v: %s", ErrRateLimited, e.Body)
+}
+
+func (e *RateLimitError) Unwrap() []error {
+	return []error{ErrRateLimited, ErrResponseError}
+}
+
+// SendError describes a failed push to the log service. It wraps the
+// classified cause, so IsConnectionError, IsResponseError and IsRateLimitError
+// keep working, and is retrieved with errors.As.
+type SendError struct {
+	// Err is the underlying cause
+	Err error
+	// StatusCode is the HTTP status of the last response, zero if none was received
+	StatusCode int
+	// Body is an excerpt of the last response body
+	Body string
+	// Endpoint is the URL the entries were pushed to
+	Endpoint string
+	// Attempts is the number of HTTP attempts made
+	Attempts int
+	// Retryable reports whether the last failure was considered transient
+	Retryable bool
+	// Streams is the number of streams in the failed push
+	Streams int
+	// Rejections lists the per-stream rejections Loki reported, if any
+	Rejections []Rejection
+}
+
+// Rejection reasons reported by Loki
+const (
+	ReasonOutOfOrder    = "out_of_order"
+	ReasonTooOld        = "too_old"
+	ReasonTooNew        = "too_new"
+	ReasonLineTooLong   = "line_too_long"
+	ReasonStreamLimit   = "stream_limit"
+	ReasonRateLimited   = "rate_limited"
+	ReasonInvalidLabels = "invalid_labels"
+	ReasonUnknown       = "unknown"
+)
+
+// Rejection describes one rejection from a Loki error response
+type Rejection struct {
+	// Stream is the rejected stream's label set, nil if the message names no stream
+	Stream map[string]string
+	// Timestamp is the rejected entry's timestamp, zero if not reported
+	Timestamp time.Time
+	// LineSize is the rejected line's length in bytes, zero if not reported
+	LineSize int
+	// Reason is one of the Reason constants
+	Reason string
+	// Message is the original message line from Loki
+	Message string
+}
+
+// RejectedEntry is a log entry that Loki refused to ingest
+type RejectedEntry struct {
+	Labels    map[string]string
+	Timestamp time.Time
+	Content   []byte
+	Reason    string
+	Message   string
+}
+
+// RejectedEntriesError reports which entries of a push Loki rejected and why.
+// It wraps the *SendError of the push.
+type RejectedEntriesError struct {
+	Err     error
+	Entries []RejectedEntry
+}
+
+func (e *RejectedEntriesError) Error() string {
+	return fmt.Sprintf("%d entries rejected: %v", len(e.Entries), e.Err)
+}
+
+func (e *RejectedEntriesError) Unwrap() error {
+	return e.Err
+}
+
+// DroppedError reports log entries the async sender gave up on. It wraps
+// ErrEntriesDropped and the last delivery error.
+type DroppedError struct {
+	// Entries is the number of log entries discarded
+	Entries int
+	// Reason describes why the entries were discarded
+	Reason string
+	// Err is the last error returned when delivering the entries
+	Err error
+}
+
+func (e *DroppedError) Error() string {
+	if e.Err == nil {
+		return fmt.Sprintf("%v: %d entries (%s)", ErrEntriesDropped, e.Entries, e.Reason)
+	}
+	return fmt.Sprintf("%v: %d entries (%s): %v", ErrEntriesDropped, e.Entries, e.Reason, e.Err)
+}
+
+func (e *DroppedError) Unwrap() []error {
+	if e.Err == nil {
+		return []error{ErrEntriesDropped}
+	}
+	return []error{ErrEntriesDropped, e.Err}
+}
+
+// UndeliveredError reports entries an async sender had not delivered when
+// FlushContext or Shutdown returned. It wraps the context error, if any.
+type UndeliveredError struct {
+	// Entries is the number of entries not delivered to the log service
+	Entries int
+	// Spooled is how many of them remain in the disk spool for the next start
+	Spooled int
+	// Fallback is how many of them were handed to the fallback sender
+	Fallback int
+	// Err is the context error that ended the wait, nil if the sender gave up on its own
+	Err error
+}
+
+func (e *UndeliveredError) Error() string {
+	msg := fmt.Sprintf("%d entries undelivered (%d spooled, %d to fallback)", e.Entries, e.Spooled, e.Fallback)
+	if e.Err != nil {
+		return msg + ": " + e.Err.Error()
+	}
+	return msg
+}
+
+func (e *UndeliveredError) Unwrap() error {
+	return e.Err
+}
+
+func (e *SendError) Error() string {
+	return fmt.Sprintf("push to %s failed after %d attempt(s): %v", e.Endpoint, e.Attempts, e.Err)
+}
+
+func (e *SendError) Unwrap() error {
+	return e.Err
+}
+
 // Error type check functions
 func IsFormatError(err error) bool {
 	return errors.Is(err, ErrInvalidFormat)
@@ -38,3 +202,16 @@ func IsConnectionError(err error) bool {
 func IsResponseError(err error) bool {
 	return errors.Is(err, ErrResponseError)
 }
+
+func IsRateLimitError(err error) bool {
+	return errors.Is(err, ErrRateLimited)
+}
+
+// RetryAfter returns the delay requested by a rate-limited response, if err is one
+func RetryAfter(err error) (time.Duration, bool) {
+	var rateLimitErr *RateLimitError
+	if errors.As(err, &rateLimitErr) {
+		return rateLimitErr.RetryAfter, true
+	}
+	return 0, false
+}
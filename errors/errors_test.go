@@ -1,8 +1,10 @@
 package errors
 
 import (
+	"context"
 	"fmt"
 	"testing"
+	"time"
 
 	stderrors "errors"
 
@@ -19,6 +21,9 @@ func TestErrorIdentification(t *testing.T) {
 		{"IsFormatError", fmt.Errorf("%w: format failed", ErrInvalidFormat), IsFormatError, true},
 		{"IsConnectionError", fmt.Errorf("%w: connection failed", ErrConnectionFailed), IsConnectionError, true},
 		{"IsResponseError", fmt.Errorf("%w: response error", ErrResponseError), IsResponseError, true},
+		{"IsRateLimitError", fmt.Errorf("%w: too many requests", ErrRateLimited), IsRateLimitError, true},
+		{"RateLimitErrorIsResponseError", &RateLimitError{}, IsResponseError, true},
+		{"ResponseErrorIsNotRateLimitError", fmt.Errorf("%w: response error", ErrResponseError), IsRateLimitError, false},
 	}
 
 	for _, tc := range testCases {
@@ -49,3 +54,67 @@ func TestNestedWrapping(t *testing.T) {
 
 	assert.True(t, IsFormatError(wrap2))
 }
+
+func TestRetryAfter(t *testing.T) {
+	err := fmt.Errorf("push failed: %w", &RateLimitError{RetryAfter: 3 * time.Second, Body: "slow down"})
+
+	delay, ok := RetryAfter(err)
+	assert.True(t, ok)
+	assert.Equal(t, 3*time.Second, delay)
+	assert.Contains(t, err.Error(), "slow down")
+
+	_, ok = RetryAfter(ErrResponseError)
+	assert.False(t, ok)
+}
+
+func TestSendError(t *testing.T) {
+	sendErr := &SendError{
+		Err:        fmt.Errorf("%w: status code 400: entry out of order", ErrResponseError),
+		StatusCode: 400,
+		Endpoint:   "http://loki/push",
+		Attempts:   2,
+	}
+	err := fmt.Errorf("async: %w", sendErr)
+
+	assert.True(t, IsResponseError(err))
+	assert.False(t, IsConnectionError(err))
+	assert.Contains(t, err.Error(), "http://loki/push")
+	assert.Contains(t, err.Error(), "2 attempt(s)")
+	assert.Contains(t, err.Error(), "entry out of order")
+
+	var target *SendError
+	assert.True(t, stderrors.As(err, &target))
+	assert.Equal(t, 400, target.StatusCode)
+
+	_, ok := RetryAfter(&SendError{Err: &RateLimitError{RetryAfter: time.Second}})
+	assert.True(t, ok)
+}
+
+func TestDroppedError(t *testing.T) {
+	cause := &SendError{Err: fmt.Errorf("%w: dial tcp", ErrConnectionFailed), Retryable: true}
+	err := &DroppedError{Entries: 7, Reason: "retry queue full", Err: cause}
+
+	assert.True(t, stderrors.Is(err, ErrEntriesDropped))
+	assert.True(t, IsConnectionError(err))
+	assert.Contains(t, err.Error(), "7 entries")
+	assert.Contains(t, err.Error(), "retry queue full")
+
+	var target *SendError
+	assert.True(t, stderrors.As(err, &target))
+	assert.True(t, target.Retryable)
+
+	// Without a cause, none is printed
+	err = &DroppedError{Entries: 2, Reason: "sender closed"}
+	assert.True(t, stderrors.Is(err, ErrEntriesDropped))
+	assert.Equal(t, "log entries dropped: 2 entries (sender closed)", err.Error())
+}
+
+func TestUndeliveredError(t *testing.T) {
+	err := error(&UndeliveredError{Entries: 5, Spooled: 3, Err: context.DeadlineExceeded})
+
+	assert.True(t, stderrors.Is(err, context.DeadlineExceeded))
+	assert.Contains(t, err.Error(), "5 entries undelivered")
+	assert.Contains(t, err.Error(), "3 spooled")
+
+	assert.NotContains(t, (&UndeliveredError{Entries: 1}).Error(), ": ")
+}
@@ -0,0 +1,148 @@
+package logger
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// AdaptiveBatchConfig bounds the batch size and flush interval chosen by
+// adaptive batching. Zero fields take their defaults.
+type AdaptiveBatchConfig struct {
+	// MinBatchSize is the smallest batch size, used when the sender is idle (default 10)
+	MinBatchSize int
+	// MaxBatchSize is the largest batch size, used under high load or latency (default 1000)
+	MaxBatchSize int
+	// MinFlushInterval is the flush interval at MinBatchSize (default 100ms)
+	MinFlushInterval time.Duration
+	// MaxFlushInterval is the flush interval at MaxBatchSize (default 5s)
+	MaxFlushInterval time.Duration
+	// TargetLatency is the push round-trip time above which batches grow (default 500ms)
+	TargetLatency time.Duration
+}
+
+const (
+	defaultMinBatchSize     = 10
+	defaultMaxBatchSize     = 1000
+	defaultMinFlushInterval = 100 * time.Millisecond
+	defaultMaxFlushInterval = 5 * time.Second
+	defaultTargetLatency    = 500 * time.Millisecond
+)
+
+// WithAdaptiveBatching lets each worker resize its batches between the
+// configured bounds: batches double when they fill up before the flush
+// interval or when Loki's push latency exceeds the target, and halve when the
+// worker is idle. The flush interval follows the batch size, so a quiet sender
+// flushes small batches quickly. WithBatchSize sets the initial size.
+func WithAdaptiveBatching(config AdaptiveBatchConfig) AsyncSenderOption {
+	return func(s *AsyncSender) {
+		if config.MinBatchSize <= 0 {
+			config.MinBatchSize = defaultMinBatchSize
+		}
+		if config.MaxBatchSize <= 0 {
+			config.MaxBatchSize = defaultMaxBatchSize
+		}
+		config.MaxBatchSize = max(config.MaxBatchSize, config.MinBatchSize)
+		if config.MinFlushInterval <= 0 {
+			config.MinFlushInterval = defaultMinFlushInterval
+		}
+		if config.MaxFlushInterval <= 0 {
+			config.MaxFlushInterval = defaultMaxFlushInterval
+		}
+		config.MaxFlushInterval = max(config.MaxFlushInterval, config.MinFlushInterval)
+		if config.TargetLatency <= 0 {
+			config.TargetLatency = defaultTargetLatency
+		}
+		s.adaptive = &config
+	}
+}
+
+// batchController holds a worker's current batch size and flush interval.
+// It is only used by the worker's goroutine.
+type batchController struct {
+	config   AdaptiveBatchConfig
+	size     int
+	interval time.Duration
+}
+
+func newBatchController(config AdaptiveBatchConfig, initial int) *batchController {
+	c := &batchController{config: config, size: min(max(initial, config.MinBatchSize), config.MaxBatchSize)}
+	c.interval = c.intervalFor(c.size)
+	return c
+}
+
+// adjust resizes the batch after a flush of n entries, triggered by a full
+// batch or by the flush interval. It reports whether the interval changed.
+func (c *batchController) adjust(n int, full bool, latency time.Duration) bool {
+	switch {
+	case full:
+		c.size = min(c.size*2, c.config.MaxBatchSize)
+	case n == 0:
+		c.size = max(c.size/2, c.config.MinBatchSize)
+	case latency > c.config.TargetLatency:
+		c.size = min(c.size*2, c.config.MaxBatchSize)
+	case n < c.size/2:
+		c.size = max(c.size/2, c.config.MinBatchSize)
+	}
+
+	interval := c.intervalFor(c.size)
+	changed := interval != c.interval
+	c.interval = interval
+	return changed
+}
+
+// intervalFor scales the flush interval linearly with the batch size
+func (c *batchController) intervalFor(size int) time.Duration {
+	span := c.config.MaxBatchSize - c.config.MinBatchSize
+	if span == 0 {
+		return c.config.MinFlushInterval
+	}
+	scale := float64(size-c.config.MinBatchSize) / float64(span)
+	return c.config.MinFlushInterval + time.Duration(scale*float64(c.config.MaxFlushInterval-c.config.MinFlushInterval))
+}
+
+// latencyAverage is an exponentially weighted moving average of push latency,
+// shared by all workers
+type latencyAverage struct {
+	nanos atomic.Int64
+}
+
+func (a *latencyAverage) observe(d time.Duration) {
+	for {
+		old := a.nanos.Load()
+		next := int64(d)
+		if old > 0 {
+			next = old + (int64(d)-old)/4
+		}
+		if a.nanos.CompareAndSwap(old, next) {
+			return
+		}
+	}
+}
+
+func (a *latencyAverage) load() time.Duration {
+	return time.Duration(a.nanos.Load())
+}
+
+// batchSize returns the worker's current batch size
+func (w *worker) batchSize() int {
+	if w.batching != nil {
+		return w.batching.size
+	}
+	return w.s.batchSize
+}
+
+// flushInterval returns the worker's current flush interval
+func (w *worker) flushInterval() time.Duration {
+	if w.batching != nil {
+		return w.batching.interval
+	}
+	return w.s.flushInterval
+}
+
+// adapt resizes the batch after a flush triggered by a full batch or the
+// ticker, and resets the ticker if the flush interval changed
+func (w *worker) adapt(ticker *time.Ticker, n int, full bool) {
+	if w.batching != nil && w.batching.adjust(n, full, w.s.latency.load()) {
+		ticker.Reset(w.batching.interval)
+	}
+}
@@ -0,0 +1,93 @@
+package logger
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBatchController_Adjust(t *testing.T) {
+	config := AdaptiveBatchConfig{
+		MinBatchSize:     10,
+		MaxBatchSize:     90,
+		MinFlushInterval: 100 * time.Millisecond,
+		MaxFlushInterval: 900 * time.Millisecond,
+		TargetLatency:    time.Second,
+	}
+	c := newBatchController(config, 5)
+	assert.Equal(t, 10, c.size)
+	assert.Equal(t, 100*time.Millisecond, c.interval)
+
+	// Full batches grow up to the maximum
+	assert.True(t, c.adjust(10, true, 0))
+	assert.Equal(t, 20, c.size)
+	assert.Equal(t, 200*time.Millisecond, c.interval)
+	c.adjust(20, true, 0)
+	c.adjust(40, true, 0)
+	c.adjust(80, true, 0)
+	assert.Equal(t, 90, c.size)
+	assert.Equal(t, 900*time.Millisecond, c.interval)
+
+	// Slow pushes keep batches large even when they are not full
+	assert.False(t, c.adjust(10, false, 2*time.Second))
+	assert.Equal(t, 90, c.size)
+
+	// A partly filled batch at the interval shrinks it
+	c.adjust(30, false, 0)
+	assert.Equal(t, 45, c.size)
+
+	// An idle worker shrinks down to the minimum, whatever the latency
+	for i := 0; i < 5; i++ {
+		c.adjust(0, false, 2*time.Second)
+	}
+	assert.Equal(t, 10, c.size)
+	assert.Equal(t, 100*time.Millisecond, c.interval)
+}
+
+func TestLatencyAverage(t *testing.T) {
+	var a latencyAverage
+	a.observe(100 * time.Millisecond)
+	assert.Equal(t, 100*time.Millisecond, a.load())
+
+	a.observe(500 * time.Millisecond)
+	assert.Equal(t, 200*time.Millisecond, a.load())
+}
+
+func TestAsyncSender_AdaptiveBatchingGrowsUnderLoad(t *testing.T) {
+	mock := &slowLogSender{}
+	sender := NewAsyncSender(mock,
+		WithBatchSize(1),
+		WithAdaptiveBatching(AdaptiveBatchConfig{MinBatchSize: 1, MaxBatchSize: 64, TargetLatency: time.Millisecond}),
+	)
+
+	labels := map[string]string{"job": "test"}
+	for i := 0; i < 200; i++ {
+		require.NoError(t, sender.Send(ctx, []byte(fmt.Sprintf(`{"i":%d}`, i)), labels, time.Now()))
+	}
+	sender.Close()
+
+	assert.Equal(t, 200, mock.totalValues())
+	assert.Less(t, len(mock.getEntries()), 100)
+	assert.Greater(t, sender.workers[0].batching.size, 1)
+}
+
+func TestAsyncSender_AdaptiveBatchingShrinksWhenIdle(t *testing.T) {
+	sender := NewAsyncSender(&asyncMockLogSender{},
+		WithBatchSize(64),
+		WithAdaptiveBatching(AdaptiveBatchConfig{
+			MinBatchSize:     1,
+			MaxBatchSize:     64,
+			MinFlushInterval: time.Millisecond,
+			MaxFlushInterval: 5 * time.Millisecond,
+		}),
+	)
+
+	time.Sleep(50 * time.Millisecond)
+	sender.Close()
+
+	assert.Equal(t, 1, sender.workers[0].batching.size)
+	assert.Equal(t, time.Millisecond, sender.workers[0].batching.interval)
+}
@@ -4,38 +4,70 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"slices"
 	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/mwazovzky/cloudlog/client"
 	"github.com/mwazovzky/cloudlog/errors"
+	"github.com/mwazovzky/cloudlog/metrics"
 )
 
+// defaultRateLimitPause is used when Loki rate-limits without a Retry-After header
+const defaultRateLimitPause = time.Second
+
 // entry represents a log entry waiting to be sent, or a flush marker.
 type entry struct {
 	content   []byte
 	labels    map[string]string
 	timestamp time.Time
 	flushCh   chan struct{} // non-nil for flush markers
+	segment   *spoolSegment // spool segment holding the entry, if spooling
+	record    int           // index of the entry's record in its spool segment
+	level     int           // LevelInfo unless the context carries a level
+	size      int64         // bytes accounted against the buffer byte limit
 }
 
 // AsyncSender implements Sender with non-blocking, buffered delivery.
-// A background worker batches entries and sends them to the underlying LogSender.
+// Background workers batch entries and send them to the underlying LogSender.
 type AsyncSender struct {
 	client        client.LogSender
-	buffer        chan entry
+	workers       []*worker
+	bufferSize    int
+	workerCount   int
+	priorityLevel int
+	priorityShare float64
 	batchSize     int
 	flushInterval time.Duration
-	blockOnFull   bool
+	overflow      OverflowConfig
 	sendTimeout   time.Duration
+	maxLineSize   int
+	linePolicy    LinePolicy
+	maxBatchBytes int
+	budget        *byteBudget // nil unless WithMaxBufferBytes
+	spoolConfig   *SpoolConfig
+	spool         *spool
+	retryConfig   *RetryQueueConfig
 	done          chan struct{}
 	wg            sync.WaitGroup
 	errorHandler  func(error)
+	fallback      Sender
+	adaptive      *AdaptiveBatchConfig
+	latency       latencyAverage // push latency, tracked for adaptive batching
+	metrics       *metrics.Registry
+	sendCtx       context.Context // cancelled when Shutdown gives up
+	abortSends    context.CancelFunc
+	pending       atomic.Int64 // entries accepted by Send and not yet delivered or dropped
 	closed        bool
 	mu            sync.Mutex
 	closeOnce     sync.Once
+
+	overflowCounters overflowCounters
+	shutdownCounters shutdownCounters
+	stats            statsCounters
 }
 
 // AsyncSenderOption configures an AsyncSender.
@@ -45,10 +77,10 @@ type AsyncSenderOption func(*AsyncSender)
 func NewAsyncSender(client client.LogSender, options ...AsyncSenderOption) *AsyncSender {
 	s := &AsyncSender{
 		client:        client,
-		buffer:        make(chan entry, 1000),
+		bufferSize:    1000,
+		workerCount:   1,
 		batchSize:     100,
 		flushInterval: 5 * time.Second,
-		blockOnFull:   false,
 		sendTimeout:   30 * time.Second,
 		done:          make(chan struct{}),
 		errorHandler:  func(err error) { log.Printf("cloudlog: send error: %v", err) },
@@ -58,8 +90,53 @@ func NewAsyncSender(client client.LogSender, options ...AsyncSenderOption) *Asyn
 		opt(s)
 	}
 
-	s.wg.Add(1)
-	go s.worker()
+	s.sendCtx, s.abortSends = context.WithCancel(context.Background())
+
+	if s.overflow.Timeout <= 0 {
+		s.overflow.Timeout = defaultOverflowTimeout
+	}
+	if s.overflow.SampleThreshold <= 0 || s.overflow.SampleThreshold > 1 {
+		s.overflow.SampleThreshold = defaultSampleThreshold
+	}
+	if s.overflow.SampleRate <= 0 {
+		s.overflow.SampleRate = defaultSampleRate
+	}
+
+	if s.spoolConfig != nil {
+		sp, err := openSpool(*s.spoolConfig)
+		if err != nil {
+			s.errorHandler(fmt.Errorf("cloudlog: spool disabled: %w", err))
+		} else {
+			s.spool = sp
+		}
+	}
+
+	// The buffer capacity is divided between the workers
+	capacity := max((s.bufferSize+s.workerCount-1)/s.workerCount, 1)
+	for i := 0; i < s.workerCount; i++ {
+		s.workers = append(s.workers, newWorker(s, capacity))
+	}
+
+	if s.metrics != nil {
+		s.metrics.RegisterBuffer(s.bufferFill)
+	}
+
+	s.wg.Add(len(s.workers))
+	if s.spool != nil {
+		s.wg.Add(1)
+	}
+	go func() {
+		// Leftover entries are replayed before any new entry is sent
+		if s.spool != nil {
+			s.replaySpool()
+		}
+		for _, w := range s.workers {
+			go w.run()
+		}
+		if s.spool != nil {
+			s.maintainSpool()
+		}
+	}()
 
 	return s
 }
@@ -68,7 +145,7 @@ func NewAsyncSender(client client.LogSender, options ...AsyncSenderOption) *Asyn
 // The caller's context is intentionally not propagated to the HTTP send —
 // entries are sent later by a background worker, and the original context
 // may already be cancelled. Use WithSendTimeout to bound HTTP send duration.
-func (s *AsyncSender) Send(_ context.Context, content []byte, labels map[string]string, timestamp time.Time) error {
+func (s *AsyncSender) Send(ctx context.Context, content []byte, labels map[string]string, timestamp time.Time) error {
 	s.mu.Lock()
 	if s.closed {
 		s.mu.Unlock()
@@ -76,177 +153,319 @@ func (s *AsyncSender) Send(_ context.Context, content []byte, labels map[string]
 	}
 	s.mu.Unlock()
 
+	if s.maxLineSize > 0 && len(content) > s.maxLineSize {
+		if s.linePolicy == LineDrop {
+			return fmt.Errorf("%w: %d bytes exceeds limit of %d", errors.ErrLineTooLong, len(content), s.maxLineSize)
+		}
+		content = truncateLine(content, s.maxLineSize)
+	}
+
 	e := entry{
 		content:   content,
 		labels:    labels,
 		timestamp: timestamp,
+		level:     LevelInfo,
+		size:      entryBytes(content, labels),
+	}
+	if level, ok := LevelFromContext(ctx); ok {
+		e.level = level
 	}
 
-	if s.blockOnFull {
-		select {
-		case s.buffer <- e:
-			return nil
-		case <-s.done:
-			return errors.ErrSenderClosed
+	w := s.workerFor(labels)
+	if s.sampled(w, e) {
+		return nil
+	}
+
+	if s.spool != nil {
+		seg, record, err := s.spool.write(e)
+		if err != nil {
+			return err
 		}
+		e.segment, e.record = seg, record
 	}
 
-	select {
-	case s.buffer <- e:
-		return nil
-	default:
-		return errors.ErrBufferFull
+	s.pending.Add(1)
+	err := s.enqueue(w, e)
+	if err != nil {
+		s.pending.Add(-1)
+		if e.segment != nil {
+			s.spool.ack(e.segment)
+		}
+		return err
+	}
+
+	s.stats.enqueued.Add(1)
+	return nil
+}
+
+// BufferedBytes returns the bytes of entries accepted by Send whose pushes have
+// not yet been sent, reported or dropped. It is zero unless WithMaxBufferBytes is set.
+func (s *AsyncSender) BufferedBytes() int64 {
+	if s.budget == nil {
+		return 0
 	}
+	return s.budget.used.Load()
 }
 
 // Flush blocks until all buffered entries have been sent.
 func (s *AsyncSender) Flush() {
-	s.mu.Lock()
-	if s.closed {
-		s.mu.Unlock()
-		return
+	_ = s.FlushContext(context.Background())
+}
+
+// Close flushes remaining entries and stops the background workers.
+// Safe for concurrent calls.
+func (s *AsyncSender) Close() {
+	_ = s.Shutdown(context.Background())
+}
+
+// labelKey returns a string key for grouping entries by their full label set.
+func labelKey(labels map[string]string) string {
+	// Build a deterministic key from sorted label pairs
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
 	}
-	s.mu.Unlock()
+	sort.Strings(keys)
+	var b strings.Builder
+	for i, k := range keys {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, "%q=%q", k, labels[k])
+	}
+	return b.String()
+}
 
-	flushCh := make(chan struct{})
-	select {
-	case s.buffer <- entry{flushCh: flushCh}:
-	case <-s.done:
+// spoolRecord identifies the spool record of an entry
+type spoolRecord struct {
+	segment *spoolSegment
+	index   int
+}
+
+// batchRelease tracks the pushes built from one batch of entries. Once every
+// push has been released, the batch's bytes return to the buffer byte budget
+// and its spool records are acknowledged, or kept if a push asked for it.
+type batchRelease struct {
+	s       *AsyncSender
+	pushes  int
+	count   int64
+	size    int64
+	records []spoolRecord
+	keep    bool
+}
+
+// newBatchRelease returns the release of a batch sent in the given number of pushes
+func (s *AsyncSender) newBatchRelease(batch []entry, pushes int) *batchRelease {
+	r := &batchRelease{s: s, pushes: pushes, count: int64(len(batch))}
+	for _, e := range batch {
+		if e.segment != nil {
+			r.records = append(r.records, spoolRecord{segment: e.segment, index: e.record})
+		}
+		r.size += e.size
+	}
+	return r
+}
+
+// release is called once per push when it has been sent, reported or dropped.
+// ack is false when the push failed transiently: the spool records of the
+// batch are then kept and sent again later (see maintainSpool).
+func (r *batchRelease) release(ack bool) {
+	if !ack {
+		r.keep = true
+	}
+	r.pushes--
+	if r.pushes > 0 {
 		return
 	}
 
-	select {
-	case <-flushCh:
-	case <-s.done:
+	s := r.s
+	s.pending.Add(-r.count)
+	for _, rec := range r.records {
+		if r.keep {
+			s.spool.keep(rec.segment, rec.index)
+		} else {
+			s.spool.ack(rec.segment)
+		}
+	}
+	if s.budget != nil {
+		s.budget.release(r.size)
 	}
 }
 
-// Close flushes remaining entries and stops the background worker.
-// Safe for concurrent calls.
-func (s *AsyncSender) Close() {
-	s.closeOnce.Do(func() {
-		s.Flush()
-
-		s.mu.Lock()
-		s.closed = true
-		s.mu.Unlock()
+// spooled reports whether every entry of the batch has a record in a spool segment that is still on disk
+func (r *batchRelease) spooled() bool {
+	s := r.s
+	if s.spool == nil || int64(len(r.records)) != r.count {
+		return false
+	}
+	segments := make([]*spoolSegment, len(r.records))
+	for i, rec := range r.records {
+		segments[i] = rec.segment
+	}
+	return s.spool.onDisk(segments)
+}
 
-		close(s.done)
-		s.wg.Wait()
-	})
+// replaySpool sends the entries of segments left over from a previous run.
+// Replayed entries are acknowledged like new ones, so a segment is deleted
+// only once all of them are done. Entries are handed to the worker owning
+// their stream, before it starts.
+func (s *AsyncSender) replaySpool() {
+	for _, path := range s.spool.takePending() {
+		entries := s.readSegment(path, nil)
+		s.pending.Add(int64(len(entries)))
+		s.stats.enqueued.Add(uint64(len(entries)))
+		for w, shard := range s.shard(entries) {
+			w.sendAll(shard)
+		}
+	}
 }
 
-// worker is the background goroutine that pulls entries, batches them, and sends.
-func (s *AsyncSender) worker() {
+// maintainSpool runs while the sender is open. Every SyncInterval it syncs
+// writes no later write has synced, and every ResendInterval it hands the
+// records kept after transient push failures back to their workers, so a
+// segment is released once its records have been re-sent.
+func (s *AsyncSender) maintainSpool() {
 	defer s.wg.Done()
 
-	batch := make([]entry, 0, s.batchSize)
-	ticker := time.NewTicker(s.flushInterval)
-	defer ticker.Stop()
+	syncTicker := time.NewTicker(s.spool.cfg.SyncInterval)
+	defer syncTicker.Stop()
+	resendTicker := time.NewTicker(s.spool.cfg.ResendInterval)
+	defer resendTicker.Stop()
 
 	for {
 		select {
-		case e := <-s.buffer:
-			if e.flushCh != nil {
-				s.sendBatch(batch)
-				batch = batch[:0]
-				close(e.flushCh)
-				continue
-			}
-
-			batch = append(batch, e)
-			if len(batch) >= s.batchSize {
-				s.sendBatch(batch)
-				batch = batch[:0]
-			}
-
-		case <-ticker.C:
-			if len(batch) > 0 {
-				s.sendBatch(batch)
-				batch = batch[:0]
-			}
-
-		case <-s.done:
-			// Drain remaining entries from buffer
-			for {
-				select {
-				case e := <-s.buffer:
-					if e.flushCh != nil {
-						s.sendBatch(batch)
-						batch = batch[:0]
-						close(e.flushCh)
-						continue
-					}
-					batch = append(batch, e)
-				default:
-					if len(batch) > 0 {
-						s.sendBatch(batch)
-					}
+		case <-syncTicker.C:
+			s.spool.syncIdle()
+
+		case <-resendTicker.C:
+			for _, seg := range s.spool.takeResend() {
+				entries := s.readSegment(seg.path, seg.kept)
+				s.stats.retried.Add(uint64(len(entries)))
+				if !s.handOff(entries) {
 					return
 				}
 			}
+
+		case <-s.done:
+			return
 		}
 	}
 }
 
-// labelKey returns a string key for grouping entries by their full label set.
-func labelKey(labels map[string]string) string {
-	// Build a deterministic key from sorted label pairs
-	keys := make([]string, 0, len(labels))
-	for k := range labels {
-		keys = append(keys, k)
+// readSegment reads the entries of a segment file to send them again, only
+// those of the given records if records is not nil. The entries belong to a
+// new segment for the file, which is settled once they are all done.
+func (s *AsyncSender) readSegment(path string, records []int) []entry {
+	all, err := readSpoolSegment(path)
+	if err != nil {
+		s.errorHandler(fmt.Errorf("cloudlog: spool replay: %w", err))
 	}
-	sort.Strings(keys)
-	var b strings.Builder
-	for i, k := range keys {
-		if i > 0 {
-			b.WriteByte(',')
+
+	entries := all[:0]
+	for i, e := range all {
+		if records == nil || slices.Contains(records, i) {
+			e.record = i
+			entries = append(entries, e)
 		}
-		fmt.Fprintf(&b, "%q=%q", k, labels[k])
 	}
-	return b.String()
-}
 
-// sendBatch groups entries by their full label set and sends one LokiEntry per group.
-func (s *AsyncSender) sendBatch(batch []entry) {
-	if len(batch) == 0 {
-		return
+	seg := s.spool.replayed(path, len(entries))
+	for i := range entries {
+		entries[i].segment = seg
 	}
+	return entries
+}
 
-	type streamGroup struct {
-		labels map[string]string
-		values [][]string
+// shard groups entries by the worker owning their stream
+func (s *AsyncSender) shard(entries []entry) map[*worker][]entry {
+	shards := make(map[*worker][]entry)
+	for _, e := range entries {
+		w := s.workerFor(e.labels)
+		shards[w] = append(shards[w], e)
 	}
+	return shards
+}
 
-	groups := make(map[string]*streamGroup)
-	for _, e := range batch {
-		key := labelKey(e.labels)
-		g, ok := groups[key]
-		if !ok {
-			g = &streamGroup{labels: e.labels}
-			groups[key] = g
+// handOff passes entries read from the spool to the running workers. It
+// returns false if the sender was closed first; the entries then stay on disk.
+func (s *AsyncSender) handOff(entries []entry) bool {
+	for w, shard := range s.shard(entries) {
+		s.pending.Add(int64(len(shard)))
+		select {
+		case w.resend <- shard:
+		case <-s.done:
+			s.pending.Add(-int64(len(shard)))
+			return false
 		}
-		g.values = append(g.values, []string{
-			fmt.Sprintf("%d", e.timestamp.UnixNano()),
-			string(e.content),
-		})
 	}
+	return true
+}
 
-	lokiEntry := client.LokiEntry{
-		Streams: make([]client.LokiStream, 0, len(groups)),
+// deliver sends a LokiEntry, returning the error of the last attempt
+func (s *AsyncSender) deliver(lokiEntry client.LokiEntry) error {
+	for {
+		err := s.send(lokiEntry)
+		if err == nil {
+			return nil
+		}
+
+		// A rate-limited batch is kept and re-sent once Loki allows it again.
+		// The worker is paused meanwhile, so new entries accumulate in the buffer.
+		delay, limited := errors.RetryAfter(err)
+		if !limited || !s.pause(delay) {
+			return err
+		}
+		s.stats.retried.Add(uint64(entryCount(lokiEntry)))
 	}
-	for _, g := range groups {
-		lokiEntry.Streams = append(lokiEntry.Streams, client.LokiStream{
-			Stream: g.labels,
-			Values: g.values,
-		})
+}
+
+// report passes a failed push to the error handler. When Loki names the
+// entries it rejected, the handler receives a *errors.RejectedEntriesError
+// listing them.
+func (s *AsyncSender) report(lokiEntry client.LokiEntry, err error) {
+	if rejected := rejectedEntries(lokiEntry, err); len(rejected) > 0 {
+		err = &errors.RejectedEntriesError{Err: err, Entries: rejected}
 	}
+	s.stats.failed.Add(uint64(entryCount(lokiEntry)))
+	s.errorHandler(err)
+}
 
-	ctx, cancel := context.WithTimeout(context.Background(), s.sendTimeout)
+// send pushes a single LokiEntry, bounded by sendTimeout
+func (s *AsyncSender) send(lokiEntry client.LokiEntry) error {
+	ctx, cancel := context.WithTimeout(s.sendCtx, s.sendTimeout)
 	defer cancel()
 
-	if err := s.client.Send(ctx, lokiEntry); err != nil {
-		s.errorHandler(err)
+	start := time.Now()
+	err := s.client.Send(ctx, lokiEntry)
+	elapsed := time.Since(start)
+	s.stats.latency.Observe(elapsed)
+	if s.adaptive != nil {
+		s.latency.observe(elapsed)
+	}
+
+	if err == nil {
+		s.stats.pushes.Add(1)
+		s.stats.sent.Add(uint64(entryCount(lokiEntry)))
+		s.stats.bytesSent.Add(uint64(entrySize(lokiEntry)))
+	}
+	return err
+}
+
+// pause suspends the worker after a rate-limited send. It returns false if the
+// sender is shutting down, in which case the batch is not retried.
+func (s *AsyncSender) pause(delay time.Duration) bool {
+	if delay <= 0 {
+		delay = defaultRateLimitPause
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-s.done:
+		return false
 	}
 }
 
@@ -255,7 +474,7 @@ func (s *AsyncSender) sendBatch(batch []entry) {
 func WithBufferSize(size int) AsyncSenderOption {
 	return func(s *AsyncSender) {
 		if size > 0 {
-			s.buffer = make(chan entry, size)
+			s.bufferSize = size
 		}
 	}
 }
@@ -278,7 +497,18 @@ func WithFlushInterval(d time.Duration) AsyncSenderOption {
 
 func WithBlockOnFull(block bool) AsyncSenderOption {
 	return func(s *AsyncSender) {
-		s.blockOnFull = block
+		if block {
+			s.overflow.Policy = OverflowBlock
+		} else {
+			s.overflow.Policy = OverflowReject
+		}
+	}
+}
+
+// WithOverflow selects how Send handles a full buffer. It supersedes WithBlockOnFull.
+func WithOverflow(cfg OverflowConfig) AsyncSenderOption {
+	return func(s *AsyncSender) {
+		s.overflow = cfg
 	}
 }
 
@@ -297,3 +527,78 @@ func WithSendTimeout(d time.Duration) AsyncSenderOption {
 		}
 	}
 }
+
+// WithMaxLineSize limits the size of a single log line in bytes. Longer lines
+// are truncated or dropped according to policy before they are buffered.
+func WithMaxLineSize(size int, policy LinePolicy) AsyncSenderOption {
+	return func(s *AsyncSender) {
+		if size > 0 {
+			s.maxLineSize = size
+			s.linePolicy = policy
+		}
+	}
+}
+
+// WithMaxBatchBytes limits the estimated size of a single push request.
+// The worker sends a batch once its entries reach size bytes, and larger
+// batches are split into several pushes.
+func WithMaxBatchBytes(size int) AsyncSenderOption {
+	return func(s *AsyncSender) {
+		if size > 0 {
+			s.maxBatchBytes = size
+		}
+	}
+}
+
+// WithRetryQueue keeps pushes that fail with a transient error and retries them
+// with backoff ahead of new entries. Pushes are only discarded by the
+// configured overflow policy or attempt limit, and reported as *errors.DroppedError.
+func WithRetryQueue(cfg RetryQueueConfig) AsyncSenderOption {
+	return func(s *AsyncSender) {
+		s.retryConfig = &cfg
+	}
+}
+
+// WithMaxBufferBytes caps the memory held by buffered and in-flight entries
+// (content plus labels). Entries that do not fit are handled by the overflow policy.
+func WithMaxBufferBytes(size int64) AsyncSenderOption {
+	return func(s *AsyncSender) {
+		if size > 0 {
+			s.budget = newByteBudget(size)
+		}
+	}
+}
+
+// WithPriorityLane reserves share (0..1) of the buffer capacity for entries at
+// minLevel and above. They are sent ahead of lower-level entries and fall back
+// to the shared buffer when their lane is full.
+func WithPriorityLane(minLevel int, share float64) AsyncSenderOption {
+	return func(s *AsyncSender) {
+		if share > 0 && share < 1 {
+			s.priorityLevel = minLevel
+			s.priorityShare = share
+		}
+	}
+}
+
+// WithWorkers sets the number of concurrent send workers. Streams are sharded
+// across workers by their label set, so each stream's entries stay in order.
+// The buffer capacity is divided between the workers, and the error handler
+// may be called from several workers at once.
+func WithWorkers(n int) AsyncSenderOption {
+	return func(s *AsyncSender) {
+		if n > 0 {
+			s.workerCount = n
+		}
+	}
+}
+
+// WithSpool persists entries to an on-disk write-ahead spool before Send returns.
+// Entries left over from a previous run are replayed when the sender starts.
+func WithSpool(cfg SpoolConfig) AsyncSenderOption {
+	return func(s *AsyncSender) {
+		if cfg.Dir != "" {
+			s.spoolConfig = &cfg
+		}
+	}
+}
@@ -3,6 +3,7 @@ package logger
 import (
 	"context"
 	"fmt"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"testing"
@@ -329,3 +330,285 @@ func TestAsyncSender_FlushAfterClose(t *testing.T) {
 	// Should return immediately, not block forever
 	sender.Flush()
 }
+
+// rateLimitedLogSender rejects the first n sends with a rate-limit error
+type rateLimitedLogSender struct {
+	remaining atomic.Int32
+	delegate  client.LogSender
+}
+
+func (r *rateLimitedLogSender) Send(ctx context.Context, entry client.LokiEntry) error {
+	if r.remaining.Add(-1) >= 0 {
+		return &errors.RateLimitError{RetryAfter: 20 * time.Millisecond}
+	}
+	return r.delegate.Send(ctx, entry)
+}
+
+func TestAsyncSender_RateLimitKeepsBatch(t *testing.T) {
+	mock := &asyncMockLogSender{}
+	limited := &rateLimitedLogSender{delegate: mock}
+	limited.remaining.Store(2)
+
+	var errorCount atomic.Int32
+	sender := NewAsyncSender(limited,
+		WithBatchSize(10),
+		WithErrorHandler(func(_ error) {
+			errorCount.Add(1)
+		}),
+	)
+	defer sender.Close()
+
+	labels := map[string]string{"job": "test"}
+	for i := 0; i < 3; i++ {
+		err := sender.Send(ctx, []byte(fmt.Sprintf(`{"i":%d}`, i)), labels, time.Now())
+		assert.NoError(t, err)
+	}
+
+	start := time.Now()
+	sender.Flush()
+
+	assert.Equal(t, 3, mock.totalValues())
+	assert.Equal(t, int32(0), errorCount.Load())
+	assert.GreaterOrEqual(t, time.Since(start), 40*time.Millisecond)
+}
+
+func TestAsyncSender_PartitionsByTenant(t *testing.T) {
+	mock := &asyncMockLogSender{}
+	sender := NewAsyncSender(mock, WithBatchSize(10))
+	defer sender.Close()
+
+	send := func(job, tenant string) {
+		labels := map[string]string{"job": job}
+		if tenant != "" {
+			labels[client.TenantLabel] = tenant
+		}
+		assert.NoError(t, sender.Send(ctx, []byte(`{"msg":"x"}`), labels, time.Now()))
+	}
+	send("svc-a", "team-a")
+	send("svc-b", "team-a")
+	send("svc-a", "team-b")
+	send("svc-a", "")
+
+	sender.Flush()
+
+	entries := mock.getEntries()
+	require.Len(t, entries, 3)
+
+	streamsByTenant := make(map[string]int)
+	for _, e := range entries {
+		streamsByTenant[e.Tenant] += len(e.Streams)
+		for _, s := range e.Streams {
+			assert.NotContains(t, s.Stream, client.TenantLabel)
+		}
+	}
+	assert.Equal(t, map[string]int{"team-a": 2, "team-b": 1, "": 1}, streamsByTenant)
+}
+
+func TestAsyncSender_ErrorHandlerReceivesSendError(t *testing.T) {
+	mock := &asyncMockLogSender{err: &errors.SendError{
+		Err:        fmt.Errorf("%w: status code 400: entry out of order", errors.ErrResponseError),
+		StatusCode: 400,
+		Streams:    1,
+	}}
+
+	errCh := make(chan error, 1)
+	sender := NewAsyncSender(mock, WithErrorHandler(func(err error) { errCh <- err }))
+	defer sender.Close()
+
+	err := sender.Send(ctx, []byte(`{"msg":"x"}`), map[string]string{"job": "test"}, time.Now())
+	assert.NoError(t, err)
+	sender.Flush()
+
+	var sendErr *errors.SendError
+	require.True(t, stderrors.As(<-errCh, &sendErr))
+	assert.Equal(t, 400, sendErr.StatusCode)
+}
+
+func TestAsyncSender_ReportsRejectedEntries(t *testing.T) {
+	ts := time.Date(2024, 1, 2, 10, 0, 0, 0, time.UTC)
+	mock := &asyncMockLogSender{err: &errors.SendError{
+		Err:        errors.ErrResponseError,
+		StatusCode: 400,
+		Rejections: []errors.Rejection{
+			{Stream: map[string]string{"job": "test"}, Timestamp: ts, Reason: errors.ReasonOutOfOrder},
+		},
+	}}
+
+	errCh := make(chan error, 1)
+	sender := NewAsyncSender(mock, WithErrorHandler(func(err error) { errCh <- err }))
+	defer sender.Close()
+
+	labels := map[string]string{"job": "test"}
+	assert.NoError(t, sender.Send(ctx, []byte(`{"msg":"late"}`), labels, ts))
+	assert.NoError(t, sender.Send(ctx, []byte(`{"msg":"ok"}`), labels, ts.Add(time.Second)))
+	sender.Flush()
+
+	var rejectedErr *errors.RejectedEntriesError
+	err := <-errCh
+	require.True(t, stderrors.As(err, &rejectedErr))
+	require.Len(t, rejectedErr.Entries, 1)
+	assert.Equal(t, `{"msg":"late"}`, string(rejectedErr.Entries[0].Content))
+	assert.Equal(t, errors.ReasonOutOfOrder, rejectedErr.Entries[0].Reason)
+	assert.True(t, errors.IsResponseError(err))
+}
+
+func TestAsyncSender_MaxLineSize(t *testing.T) {
+	mock := &asyncMockLogSender{}
+	sender := NewAsyncSender(mock, WithMaxLineSize(32, LineTruncate))
+	defer sender.Close()
+
+	labels := map[string]string{"job": "test"}
+	err := sender.Send(ctx, []byte(strings.Repeat("a", 100)), labels, time.Now())
+	assert.NoError(t, err)
+	sender.Flush()
+
+	entries := mock.getEntries()
+	require.Len(t, entries, 1)
+	line := entries[0].Streams[0].Values[0][1]
+	assert.Len(t, line, 32)
+	assert.True(t, strings.HasSuffix(line, TruncationMarker))
+
+	dropping := NewAsyncSender(mock, WithMaxLineSize(32, LineDrop))
+	defer dropping.Close()
+
+	err = dropping.Send(ctx, []byte(strings.Repeat("a", 100)), labels, time.Now())
+	assert.True(t, stderrors.Is(err, errors.ErrLineTooLong))
+	assert.NoError(t, dropping.Send(ctx, []byte("short"), labels, time.Now()))
+}
+
+func TestAsyncSender_MaxBatchBytesSplitsPushes(t *testing.T) {
+	mock := &asyncMockLogSender{}
+	sender := NewAsyncSender(mock, WithBatchSize(100), WithMaxBatchBytes(1024))
+	defer sender.Close()
+
+	labels := map[string]string{"job": "test"}
+	for i := 0; i < 20; i++ {
+		err := sender.Send(ctx, []byte(fmt.Sprintf(`{"i":%d,"pad":"%s"}`, i, strings.Repeat("p", 200))), labels, time.Now())
+		assert.NoError(t, err)
+	}
+	sender.Flush()
+
+	entries := mock.getEntries()
+	assert.Greater(t, len(entries), 1)
+	assert.Equal(t, 20, mock.totalValues())
+}
+
+// flakyLogSender fails its first failures calls with a retryable SendError
+type flakyLogSender struct {
+	asyncMockLogSender
+	failures atomic.Int32
+}
+
+func (f *flakyLogSender) Send(ctx context.Context, entry client.LokiEntry) error {
+	if f.failures.Add(-1) >= 0 {
+		return &errors.SendError{Err: errors.ErrConnectionFailed, Retryable: true}
+	}
+	return f.asyncMockLogSender.Send(ctx, entry)
+}
+
+func TestAsyncSender_RetryQueueRedeliversInOrder(t *testing.T) {
+	mock := &flakyLogSender{}
+	mock.failures.Store(2)
+
+	var errs []error
+	sender := NewAsyncSender(mock,
+		WithFlushInterval(time.Hour),
+		WithRetryQueue(RetryQueueConfig{BaseDelay: 10 * time.Millisecond}),
+		WithErrorHandler(func(err error) { errs = append(errs, err) }),
+	)
+
+	labels := map[string]string{"job": "test"}
+	require.NoError(t, sender.Send(ctx, []byte("first"), labels, time.Now()))
+	sender.Flush() // initial push and forced retry both fail
+
+	require.NoError(t, sender.Send(ctx, []byte("second"), labels, time.Now()))
+	sender.Flush() // queued behind the first push, then both are delivered
+	sender.Close()
+
+	assert.Empty(t, errs)
+	entries := mock.getEntries()
+	require.Len(t, entries, 2)
+	assert.Equal(t, "first", entries[0].Streams[0].Values[0][1])
+	assert.Equal(t, "second", entries[1].Streams[0].Values[0][1])
+}
+
+func TestAsyncSender_RetryQueueRetriesWithBackoff(t *testing.T) {
+	mock := &flakyLogSender{}
+	mock.failures.Store(1)
+
+	sender := NewAsyncSender(mock,
+		WithBatchSize(1),
+		WithFlushInterval(time.Hour),
+		WithRetryQueue(RetryQueueConfig{BaseDelay: 10 * time.Millisecond}),
+	)
+	defer sender.Close()
+
+	require.NoError(t, sender.Send(ctx, []byte("hello"), map[string]string{"job": "test"}, time.Now()))
+
+	assert.Eventually(t, func() bool { return mock.totalValues() == 1 }, time.Second, 5*time.Millisecond)
+}
+
+func TestAsyncSender_RetryQueueOverflow(t *testing.T) {
+	tests := []struct {
+		name     string
+		overflow RetryOverflow
+		kept     string
+	}{
+		{"drop oldest", RetryDropOldest, "c"},
+		{"drop newest", RetryDropNewest, "a"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := &flakyLogSender{}
+			mock.failures.Store(3)
+
+			var dropped []*errors.DroppedError
+			sender := NewAsyncSender(mock,
+				WithFlushInterval(time.Hour),
+				WithRetryQueue(RetryQueueConfig{MaxBatches: 1, BaseDelay: time.Hour, Overflow: tt.overflow}),
+				WithErrorHandler(func(err error) {
+					var dropErr *errors.DroppedError
+					require.True(t, stderrors.As(err, &dropErr))
+					dropped = append(dropped, dropErr)
+				}),
+			)
+
+			labels := map[string]string{"job": "test"}
+			for _, content := range []string{"a", "b", "c"} {
+				require.NoError(t, sender.Send(ctx, []byte(content), labels, time.Now()))
+				sender.Flush()
+			}
+			sender.Close()
+
+			require.Len(t, dropped, 2)
+			for _, dropErr := range dropped {
+				assert.Equal(t, 1, dropErr.Entries)
+				assert.Equal(t, "retry queue full", dropErr.Reason)
+				assert.True(t, errors.IsConnectionError(dropErr))
+			}
+
+			entries := mock.getEntries()
+			require.Len(t, entries, 1)
+			assert.Equal(t, tt.kept, entries[0].Streams[0].Values[0][1])
+		})
+	}
+}
+
+func TestAsyncSender_RetryQueueMaxAttempts(t *testing.T) {
+	mock := &flakyLogSender{}
+	mock.failures.Store(100)
+
+	var dropErr *errors.DroppedError
+	sender := NewAsyncSender(mock,
+		WithRetryQueue(RetryQueueConfig{MaxAttempts: 2}),
+		WithErrorHandler(func(err error) { require.True(t, stderrors.As(err, &dropErr)) }),
+	)
+
+	require.NoError(t, sender.Send(ctx, []byte("hello"), map[string]string{"job": "test"}, time.Now()))
+	sender.Close()
+
+	require.NotNil(t, dropErr)
+	assert.Equal(t, "retry attempts exhausted", dropErr.Reason)
+	assert.Equal(t, 0, mock.totalValues())
+}
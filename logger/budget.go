@@ -0,0 +1,95 @@
+package logger
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// byteBudget tracks the bytes held by an AsyncSender, from Send until the
+// entry's push has been sent, reported or dropped
+type byteBudget struct {
+	limit int64
+	used  atomic.Int64
+
+	mu    sync.Mutex
+	freed chan struct{} // closed and replaced whenever bytes are released
+}
+
+func newByteBudget(limit int64) *byteBudget {
+	return &byteBudget{limit: limit, freed: make(chan struct{})}
+}
+
+// reserve atomically claims n bytes, reporting false if they do not fit.
+// An entry larger than the whole budget is admitted when nothing else is held.
+func (b *byteBudget) reserve(n int64) bool {
+	for {
+		used := b.used.Load()
+		if used > 0 && used+n > b.limit {
+			return false
+		}
+		if b.used.CompareAndSwap(used, used+n) {
+			return true
+		}
+	}
+}
+
+// release returns n bytes to the budget and wakes waiting senders
+func (b *byteBudget) release(n int64) {
+	if n == 0 {
+		return
+	}
+	b.used.Add(-n)
+
+	b.mu.Lock()
+	close(b.freed)
+	b.freed = make(chan struct{})
+	b.mu.Unlock()
+}
+
+// released returns a channel that is closed on the next release
+func (b *byteBudget) released() <-chan struct{} {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.freed
+}
+
+// fill returns the fraction of the budget in use
+func (b *byteBudget) fill() float64 {
+	return float64(b.used.Load()) / float64(b.limit)
+}
+
+// entryBytes returns the memory accounted for an entry: its content and labels
+func entryBytes(content []byte, labels map[string]string) int64 {
+	size := len(content)
+	for k, v := range labels {
+		size += len(k) + len(v)
+	}
+	return int64(size)
+}
+
+// waitTimer lazily starts the OverflowBlockTimeout timer, so the fast path of
+// Send does not allocate one
+type waitTimer struct {
+	timeout time.Duration
+	timer   *time.Timer
+	waited  bool
+}
+
+// C returns the timer channel, nil when waiting is unbounded
+func (w *waitTimer) C() <-chan time.Time {
+	w.waited = true
+	if w.timeout <= 0 {
+		return nil
+	}
+	if w.timer == nil {
+		w.timer = time.NewTimer(w.timeout)
+	}
+	return w.timer.C
+}
+
+func (w *waitTimer) stop() {
+	if w.timer != nil {
+		w.timer.Stop()
+	}
+}
@@ -0,0 +1,116 @@
+package logger
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mwazovzky/cloudlog/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestByteBudget_Reserve(t *testing.T) {
+	b := newByteBudget(100)
+
+	assert.True(t, b.reserve(60))
+	assert.False(t, b.reserve(50))
+	assert.True(t, b.reserve(40))
+
+	freed := b.released()
+	b.release(60)
+	select {
+	case <-freed:
+	default:
+		t.Fatal("release did not wake waiters")
+	}
+	assert.Equal(t, int64(40), b.used.Load())
+
+	// An entry larger than the whole budget is admitted only when nothing else is held
+	assert.False(t, b.reserve(500))
+	b.release(40)
+	assert.True(t, b.reserve(500))
+}
+
+func TestByteBudget_ConcurrentReserve(t *testing.T) {
+	b := newByteBudget(1000)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				if b.reserve(30) {
+					assert.LessOrEqual(t, b.used.Load(), int64(1000))
+					b.release(30)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Zero(t, b.used.Load())
+}
+
+func TestAsyncSender_MaxBufferBytes(t *testing.T) {
+	mock := &asyncMockLogSender{}
+	sender, release := stalledSender(t, mock, WithMaxBufferBytes(40))
+
+	// Each entry accounts for its content plus labels: "job"+"test" = 7 bytes
+	labels := map[string]string{"job": "test"}
+	assert.Equal(t, int64(12), sender.BufferedBytes()) // "first", held by the blocked push
+
+	assert.NoError(t, sender.Send(ctx, []byte("0123456789"), labels, time.Now()))
+	assert.ErrorIs(t, sender.Send(ctx, []byte("0123456789"), labels, time.Now()), errors.ErrBufferFull)
+	assert.Equal(t, int64(29), sender.BufferedBytes())
+
+	release()
+	sender.Flush()
+	assert.Zero(t, sender.BufferedBytes())
+
+	sender.Close()
+	assert.Equal(t, 2, mock.totalValues())
+	assert.Equal(t, uint64(1), sender.OverflowStats().Rejected)
+}
+
+func TestAsyncSender_MaxBufferBytesBlocks(t *testing.T) {
+	mock := &asyncMockLogSender{}
+	sender, release := stalledSender(t, mock,
+		WithMaxBufferBytes(30),
+		WithOverflow(OverflowConfig{Policy: OverflowBlock}),
+	)
+
+	labels := map[string]string{"job": "test"}
+	require.NoError(t, sender.Send(ctx, []byte("0123456789"), labels, time.Now()))
+
+	sent := make(chan error)
+	go func() { sent <- sender.Send(ctx, []byte("0123456789"), labels, time.Now()) }()
+
+	select {
+	case <-sent:
+		t.Fatal("Send did not wait for buffer bytes")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	release()
+	assert.NoError(t, <-sent)
+	sender.Close()
+
+	assert.Equal(t, 3, mock.totalValues())
+	assert.Equal(t, uint64(1), sender.OverflowStats().Blocked)
+}
+
+func TestAsyncSender_MaxBatchBytesSendsEarly(t *testing.T) {
+	mock := &asyncMockLogSender{}
+	sender := NewAsyncSender(mock, WithFlushInterval(time.Hour), WithMaxBatchBytes(30))
+	defer sender.Close()
+
+	labels := map[string]string{"job": "test"}
+	for i := 0; i < 3; i++ {
+		require.NoError(t, sender.Send(ctx, []byte("0123456789"), labels, time.Now()))
+	}
+
+	// The first two entries reach the batch byte limit and are sent without a flush
+	require.Eventually(t, func() bool { return mock.totalValues() == 2 }, time.Second, time.Millisecond)
+}
@@ -0,0 +1,52 @@
+package logger
+
+import (
+	"context"
+	"log/slog"
+	"sync/atomic"
+)
+
+type loggerContextKey struct{}
+
+// defaultLogger holds the Logger set by SetDefault
+var defaultLogger atomic.Pointer[Logger]
+
+// NewContext returns a context carrying the logger, for FromContext to retrieve
+func NewContext(ctx context.Context, l Logger) context.Context {
+	return context.WithValue(ctx, loggerContextKey{}, l)
+}
+
+// FromContext returns the logger stored by NewContext, or Default if there is none
+func FromContext(ctx context.Context) Logger {
+	if l, ok := ctx.Value(loggerContextKey{}).(Logger); ok && l != nil {
+		return l
+	}
+	return Default()
+}
+
+// ContextWith returns a context whose logger is the context's logger with the
+// key-values added, so metadata set in middleware appears in every entry
+// logged further down the call chain
+func ContextWith(ctx context.Context, keyvals ...interface{}) context.Context {
+	return NewContext(ctx, FromContext(ctx).With(keyvals...))
+}
+
+// SetDefault sets the logger FromContext returns for contexts without one.
+// Passing nil restores the initial default.
+func SetDefault(l Logger) {
+	if l == nil {
+		defaultLogger.Store(nil)
+		return
+	}
+	defaultLogger.Store(&l)
+}
+
+// Default returns the logger set by SetDefault. Until one is set, it returns a
+// logger writing to slog.Default(), so entries are not lost before a cloudlog
+// logger is configured.
+func Default() Logger {
+	if l := defaultLogger.Load(); l != nil {
+		return *l
+	}
+	return NewSlogLogger(slog.Default().Handler())
+}
@@ -0,0 +1,62 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestContext_FromContext(t *testing.T) {
+	sender := &mockSender{}
+	log := New(sender, WithJob("api"))
+
+	logCtx := NewContext(ctx, log)
+	assert.Same(t, log, FromContext(logCtx))
+
+	require.NoError(t, FromContext(logCtx).Info(logCtx, "hello"))
+	assert.Len(t, sender.contents, 1)
+}
+
+func TestContext_ContextWith(t *testing.T) {
+	sender := &mockSender{}
+	logCtx := NewContext(ctx, New(sender, WithMetadata("env", "prod")))
+
+	// Middleware enriches the request context...
+	logCtx = ContextWith(logCtx, "request_id", "r1")
+	logCtx = ContextWith(logCtx, "user_id", 7)
+
+	// ...and a deep call site picks it up
+	require.NoError(t, FromContext(logCtx).Info(logCtx, "deep"))
+
+	records := decodeContents(t, sender)
+	require.Len(t, records, 1)
+	assert.Equal(t, "prod", records[0]["env"])
+	assert.Equal(t, "r1", records[0]["request_id"])
+	assert.Equal(t, float64(7), records[0]["user_id"])
+}
+
+func TestContext_Default(t *testing.T) {
+	// Without a logger in the context, entries go to slog.Default()
+	var buf bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&buf, nil)))
+	defer slog.SetDefault(previous)
+
+	require.NoError(t, FromContext(context.Background()).Warn(ctx, "fallback", "k", "v"))
+	assert.Contains(t, buf.String(), "msg=fallback k=v")
+
+	// ContextWith also works on a context without a logger
+	require.NoError(t, FromContext(ContextWith(ctx, "a", 1)).Info(ctx, "enriched"))
+	assert.Contains(t, buf.String(), "msg=enriched a=1")
+
+	sender := &mockSender{}
+	SetDefault(New(sender))
+	defer SetDefault(nil)
+
+	require.NoError(t, FromContext(ctx).Info(ctx, "configured"))
+	assert.Len(t, sender.contents, 1)
+}
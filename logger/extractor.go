@@ -0,0 +1,152 @@
+package logger
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/mwazovzky/cloudlog/errors"
+)
+
+// ContextExtractor returns key-value pairs to add to every entry logged with ctx.
+// Keys given at the call site take precedence over extracted ones.
+type ContextExtractor func(ctx context.Context) []interface{}
+
+// defaultExtractors are used by every logger unless replaced by WithContextExtractors
+var defaultExtractors = []ContextExtractor{TraceExtractor, RequestIDExtractor}
+
+// WithContextExtractor adds extractors that are run on the context of every log call,
+// in addition to the built-in trace and request ID extractors
+func WithContextExtractor(extractors ...ContextExtractor) Option {
+	return func(l *logger) {
+		l.extractors = append(l.extractors[:len(l.extractors):len(l.extractors)], extractors...)
+	}
+}
+
+// WithContextExtractors replaces all extractors, including the built-in ones.
+// Call it without arguments to stop reading fields from the context.
+func WithContextExtractors(extractors ...ContextExtractor) Option {
+	return func(l *logger) {
+		l.extractors = append([]ContextExtractor{}, extractors...)
+	}
+}
+
+// contextKeyvals runs the logger's extractors on ctx
+func (l *logger) contextKeyvals(ctx context.Context) []interface{} {
+	var keyvals []interface{}
+	for _, extract := range l.extractors {
+		keyvals = append(keyvals, extract(ctx)...)
+	}
+	return keyvals
+}
+
+// TraceContext identifies the trace and span an entry belongs to, as carried
+// by the W3C traceparent header
+type TraceContext struct {
+	TraceID string // 32 lowercase hex characters
+	SpanID  string // 16 lowercase hex characters
+	Sampled bool
+}
+
+type traceContextKey struct{}
+
+// ContextWithTraceContext returns a context whose log entries carry the trace and span IDs
+func ContextWithTraceContext(ctx context.Context, tc TraceContext) context.Context {
+	return context.WithValue(ctx, traceContextKey{}, tc)
+}
+
+// TraceContextFromContext returns the trace context stored by ContextWithTraceContext, if any
+func TraceContextFromContext(ctx context.Context) (TraceContext, bool) {
+	tc, ok := ctx.Value(traceContextKey{}).(TraceContext)
+	return tc, ok
+}
+
+// ParseTraceparent parses a W3C traceparent header ("00-<trace-id>-<span-id>-<flags>").
+// It returns ErrInvalidInput if the header is malformed or the IDs are all zeros.
+func ParseTraceparent(header string) (TraceContext, error) {
+	parts := strings.Split(strings.TrimSpace(header), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" ||
+		(parts[0] == "00" && len(parts) != 4) {
+		return TraceContext{}, fmt.Errorf("%w: malformed traceparent %q", errors.ErrInvalidInput, header)
+	}
+
+	traceID, spanID, flags := parts[1], parts[2], parts[3]
+	if !isHexID(parts[0], 2) || !isHexID(traceID, 32) || !isHexID(spanID, 16) || !isHexID(flags, 2) {
+		return TraceContext{}, fmt.Errorf("%w: malformed traceparent %q", errors.ErrInvalidInput, header)
+	}
+
+	flagBits, _ := hex.DecodeString(flags)
+	return TraceContext{TraceID: traceID, SpanID: spanID, Sampled: flagBits[0]&1 == 1}, nil
+}
+
+// Traceparent formats the trace context as a W3C traceparent header
+func (tc TraceContext) Traceparent() string {
+	flags := "00"
+	if tc.Sampled {
+		flags = "01"
+	}
+	return "00-" + tc.TraceID + "-" + tc.SpanID + "-" + flags
+}
+
+// isHexID reports whether s is n lowercase hex characters, not all zeros
+func isHexID(s string, n int) bool {
+	if len(s) != n {
+		return false
+	}
+	nonZero := n == 2 // version and flags may be zero
+	for _, c := range s {
+		switch {
+		case c >= '1' && c <= '9', c >= 'a' && c <= 'f':
+			nonZero = true
+		case c != '0':
+			return false
+		}
+	}
+	return nonZero
+}
+
+// TraceExtractor adds "trace_id" and "span_id" from a context set by ContextWithTraceContext
+func TraceExtractor(ctx context.Context) []interface{} {
+	tc, ok := TraceContextFromContext(ctx)
+	if !ok {
+		return nil
+	}
+	keyvals := []interface{}{"trace_id", tc.TraceID}
+	if tc.SpanID != "" {
+		keyvals = append(keyvals, "span_id", tc.SpanID)
+	}
+	return keyvals
+}
+
+type requestIDContextKey struct{}
+
+// ContextWithRequestID returns a context whose log entries carry the request ID
+func ContextWithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDContextKey{}, id)
+}
+
+// RequestIDFromContext returns the request ID stored by ContextWithRequestID, if any
+func RequestIDFromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(requestIDContextKey{}).(string)
+	return id, ok && id != ""
+}
+
+// RequestIDExtractor adds "request_id" from a context set by ContextWithRequestID
+func RequestIDExtractor(ctx context.Context) []interface{} {
+	if id, ok := RequestIDFromContext(ctx); ok {
+		return []interface{}{"request_id", id}
+	}
+	return nil
+}
+
+// ContextValueExtractor returns an extractor that logs ctx.Value(key) as field,
+// for values stored under the application's own context keys
+func ContextValueExtractor(field string, key interface{}) ContextExtractor {
+	return func(ctx context.Context) []interface{} {
+		if value := ctx.Value(key); value != nil {
+			return []interface{}{field, value}
+		}
+		return nil
+	}
+}
@@ -0,0 +1,87 @@
+package logger
+
+import (
+	"context"
+	stderrors "errors"
+	"log/slog"
+	"testing"
+
+	"github.com/mwazovzky/cloudlog/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	tc, err := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	require.NoError(t, err)
+	assert.Equal(t, TraceContext{TraceID: "4bf92f3577b34da6a3ce929d0e0e4736", SpanID: "00f067aa0ba902b7", Sampled: true}, tc)
+	assert.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", tc.Traceparent())
+
+	// Later versions may append fields
+	_, err = ParseTraceparent("01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00-extra")
+	assert.NoError(t, err)
+
+	for _, header := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e473-00f067aa0ba902b7-01",
+	} {
+		_, err := ParseTraceparent(header)
+		assert.True(t, stderrors.Is(err, errors.ErrInvalidInput), header)
+	}
+}
+
+func TestLogger_ContextExtractors(t *testing.T) {
+	sender := &mockSender{}
+	log := New(sender)
+
+	tc, err := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	require.NoError(t, err)
+	logCtx := ContextWithRequestID(ContextWithTraceContext(ctx, tc), "req-1")
+
+	require.NoError(t, log.Info(logCtx, "traced"))
+	require.NoError(t, log.Info(logCtx, "explicit", "request_id", "override"))
+	require.NoError(t, log.Info(ctx, "plain"))
+
+	records := decodeContents(t, sender)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", records[0]["trace_id"])
+	assert.Equal(t, "00f067aa0ba902b7", records[0]["span_id"])
+	assert.Equal(t, "req-1", records[0]["request_id"])
+	assert.Equal(t, "override", records[1]["request_id"])
+	assert.NotContains(t, records[2], "trace_id")
+	assert.NotContains(t, records[2], "request_id")
+}
+
+type userKey struct{}
+
+func TestLogger_CustomContextExtractor(t *testing.T) {
+	sender := &mockSender{}
+	log := New(sender, WithContextExtractor(ContextValueExtractor("user_id", userKey{})), WithLabelKeys("user_id"))
+
+	userCtx := ContextWithRequestID(context.WithValue(ctx, userKey{}, 42), "req-1")
+	require.NoError(t, log.With("k", "v").Warn(userCtx, "hello"))
+
+	records := decodeContents(t, sender)
+	assert.Equal(t, "req-1", records[0]["request_id"])
+	assert.Equal(t, map[string]string{"job": "application", "user_id": "42"}, sender.labels[0])
+
+	// Replacing the extractors drops the built-in ones
+	sender = &mockSender{}
+	log = New(sender, WithContextExtractors())
+	require.NoError(t, log.Info(userCtx, "hello"))
+	assert.NotContains(t, decodeContents(t, sender)[0], "request_id")
+}
+
+func TestSlogHandler_ContextExtractors(t *testing.T) {
+	sender := &mockSender{}
+	log := slog.New(NewSlogHandler(sender))
+
+	log.InfoContext(ContextWithRequestID(ctx, "req-1"), "hello")
+
+	assert.Equal(t, "req-1", decodeContents(t, sender)[0]["request_id"])
+}
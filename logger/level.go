@@ -0,0 +1,18 @@
+package logger
+
+import "context"
+
+type levelContextKey struct{}
+
+// ContextWithLevel returns a context carrying the level of the entry being sent.
+// The logger sets it on the context passed to Sender.Send, so senders can
+// treat entries differently by level.
+func ContextWithLevel(ctx context.Context, level int) context.Context {
+	return context.WithValue(ctx, levelContextKey{}, level)
+}
+
+// LevelFromContext returns the level stored by ContextWithLevel, if any
+func LevelFromContext(ctx context.Context) (int, bool) {
+	level, ok := ctx.Value(levelContextKey{}).(int)
+	return level, ok
+}
@@ -0,0 +1,137 @@
+package logger
+
+import (
+	"unicode/utf8"
+
+	"github.com/mwazovzky/cloudlog/client"
+)
+
+// LinePolicy decides what happens to lines longer than the configured maximum
+type LinePolicy int
+
+const (
+	// LineTruncate cuts long lines and appends TruncationMarker
+	LineTruncate LinePolicy = iota
+	// LineDrop discards long lines; Send returns ErrLineTooLong
+	LineDrop
+)
+
+// TruncationMarker is appended to lines shortened by LineTruncate
+const TruncationMarker = "...[truncated]"
+
+// Approximate JSON framing overhead of a value (["<ns>","..."],) and a stream
+const (
+	valueOverhead  = 26
+	streamOverhead = 32
+)
+
+// truncateLine shortens content to at most size bytes including the marker,
+// without splitting a UTF-8 sequence
+func truncateLine(content []byte, size int) []byte {
+	keep := size - len(TruncationMarker)
+	if keep <= 0 {
+		return []byte(TruncationMarker[:size])
+	}
+	for keep > 0 && !utf8.RuneStart(content[keep]) {
+		keep--
+	}
+
+	truncated := make([]byte, 0, keep+len(TruncationMarker))
+	truncated = append(truncated, content[:keep]...)
+	return append(truncated, TruncationMarker...)
+}
+
+// jsonStringSize returns the length of s once escaped as a JSON string.
+// Rare escapes (U+2028, U+2029, invalid UTF-8) are not accounted for.
+func jsonStringSize(s string) int {
+	size := len(s) + 2
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '"' || c == '\\' || c == '\n' || c == '\r' || c == '\t' || c == '\b' || c == '\f':
+			size++
+		case c < 0x20 || c == '<' || c == '>' || c == '&':
+			size += 5
+		}
+	}
+	return size
+}
+
+// streamSize estimates the encoded size of a stream without its values
+func streamSize(stream map[string]string) int {
+	size := streamOverhead
+	for k, v := range stream {
+		size += jsonStringSize(k) + jsonStringSize(v) + 2
+	}
+	return size
+}
+
+// entrySize estimates the encoded size of a LokiEntry
+func entrySize(lokiEntry client.LokiEntry) int {
+	size := 0
+	for _, stream := range lokiEntry.Streams {
+		size += streamSize(stream.Stream)
+		for _, value := range stream.Values {
+			size += valueOverhead + jsonStringSize(value[1])
+		}
+	}
+	return size
+}
+
+// entryCount returns the number of log entries in a LokiEntry
+func entryCount(lokiEntry client.LokiEntry) int {
+	count := 0
+	for _, stream := range lokiEntry.Streams {
+		count += len(stream.Values)
+	}
+	return count
+}
+
+// splitEntry divides a LokiEntry into pushes whose estimated encoded size stays
+// within maxBytes. Values keep their order, so per-stream ordering is preserved
+// across the resulting pushes. A single value larger than maxBytes is sent alone.
+func splitEntry(lokiEntry client.LokiEntry, maxBytes int) []client.LokiEntry {
+	if maxBytes <= 0 {
+		return []client.LokiEntry{lokiEntry}
+	}
+
+	var chunks []client.LokiEntry
+	current := client.LokiEntry{Tenant: lokiEntry.Tenant}
+	currentSize := 0
+
+	for _, stream := range lokiEntry.Streams {
+		labelsSize := streamSize(stream.Stream)
+		var values [][]string
+
+		for _, value := range stream.Values {
+			valueSize := valueOverhead + jsonStringSize(value[1])
+
+			added := valueSize
+			if len(values) == 0 {
+				added += labelsSize
+			}
+			if currentSize > 0 && currentSize+added > maxBytes {
+				if len(values) > 0 {
+					current.Streams = append(current.Streams, client.LokiStream{Stream: stream.Stream, Values: values})
+				}
+				chunks = append(chunks, current)
+				current = client.LokiEntry{Tenant: lokiEntry.Tenant}
+				currentSize = 0
+				values = nil
+				added = labelsSize + valueSize
+			}
+
+			values = append(values, value)
+			currentSize += added
+		}
+
+		if len(values) > 0 {
+			current.Streams = append(current.Streams, client.LokiStream{Stream: stream.Stream, Values: values})
+		}
+	}
+
+	if len(current.Streams) > 0 {
+		chunks = append(chunks, current)
+	}
+
+	return chunks
+}
@@ -0,0 +1,89 @@
+package logger
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/mwazovzky/cloudlog/client"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTruncateLine(t *testing.T) {
+	truncated := truncateLine([]byte(strings.Repeat("a", 100)), 30)
+	assert.Len(t, truncated, 30)
+	assert.True(t, strings.HasSuffix(string(truncated), TruncationMarker))
+
+	// Multi-byte runes are not split
+	truncated = truncateLine([]byte(strings.Repeat("é", 50)), 21)
+	assert.LessOrEqual(t, len(truncated), 21)
+	assert.Equal(t, "ééé"+TruncationMarker, string(truncated))
+
+	assert.Equal(t, "...", string(truncateLine([]byte("abcdefgh"), 3)))
+}
+
+func TestJSONStringSize(t *testing.T) {
+	for _, s := range []string{"", "plain", `{"a":"b\\c"}`, "tab\there\n", "bell\x07", "<a&b>"} {
+		encoded, err := json.Marshal(s)
+		require.NoError(t, err)
+		assert.Equal(t, len(encoded), jsonStringSize(s), s)
+	}
+}
+
+func TestSplitEntry(t *testing.T) {
+	line := strings.Repeat("x", 100)
+	values := func(prefix string, n int) [][]string {
+		v := make([][]string, n)
+		for i := range v {
+			v[i] = []string{fmt.Sprintf("%s%03d", prefix, i), line}
+		}
+		return v
+	}
+
+	lokiEntry := client.LokiEntry{
+		Tenant: "team-a",
+		Streams: []client.LokiStream{
+			{Stream: map[string]string{"job": "a"}, Values: values("1", 10)},
+			{Stream: map[string]string{"job": "b"}, Values: values("2", 10)},
+		},
+	}
+
+	chunks := splitEntry(lokiEntry, 600)
+	require.Greater(t, len(chunks), 4)
+
+	seen := map[string][]string{}
+	for _, chunk := range chunks {
+		assert.Equal(t, "team-a", chunk.Tenant)
+
+		data, err := json.Marshal(chunk)
+		require.NoError(t, err)
+		assert.LessOrEqual(t, len(data), 600)
+
+		for _, s := range chunk.Streams {
+			for _, v := range s.Values {
+				seen[s.Stream["job"]] = append(seen[s.Stream["job"]], v[0])
+			}
+		}
+	}
+
+	// Every value is sent exactly once, in order
+	assert.Equal(t, lokiEntry.Streams[0].Values, toValues(seen["a"], line))
+	assert.Equal(t, lokiEntry.Streams[1].Values, toValues(seen["b"], line))
+
+	// No limit returns the entry unchanged
+	assert.Equal(t, []client.LokiEntry{lokiEntry}, splitEntry(lokiEntry, 0))
+
+	// Oversized single values are sent alone
+	chunks = splitEntry(lokiEntry, 10)
+	assert.Len(t, chunks, 20)
+}
+
+func toValues(timestamps []string, line string) [][]string {
+	v := make([][]string, len(timestamps))
+	for i, ts := range timestamps {
+		v[i] = []string{ts, line}
+	}
+	return v
+}
@@ -4,18 +4,23 @@ import (
 	"context"
 	"fmt"
 
+	"github.com/mwazovzky/cloudlog/client"
 	"github.com/mwazovzky/cloudlog/errors"
 	"github.com/mwazovzky/cloudlog/formatter"
+	"github.com/mwazovzky/cloudlog/metrics"
 )
 
 // logger implements the Logger interface
 type logger struct {
-	formatter formatter.Formatter
-	job       string
-	metadata  map[string]interface{}
-	sender    Sender
-	labelKeys []string
-	minLevel  int
+	formatter  formatter.Formatter
+	job        string
+	metadata   map[string]interface{}
+	sender     Sender
+	labelKeys  []string
+	minLevel   int
+	tenant     string
+	metrics    *metrics.Registry
+	extractors []ContextExtractor
 }
 
 // Log level constants
@@ -39,11 +44,12 @@ type Option func(*logger)
 // New creates a new Logger with the given sender and options
 func New(sender Sender, options ...Option) Logger {
 	l := &logger{
-		formatter: formatter.NewLokiFormatter(),
-		job:       "application",
-		metadata:  make(map[string]interface{}),
-		sender:    sender,
-		minLevel:  LevelDebug,
+		formatter:  formatter.NewLokiFormatter(),
+		job:        "application",
+		metadata:   make(map[string]interface{}),
+		sender:     sender,
+		minLevel:   LevelDebug,
+		extractors: defaultExtractors,
 	}
 
 	for _, option := range options {
@@ -71,12 +77,15 @@ func (l *logger) Warn(ctx context.Context, message string, keyvals ...interface{
 
 func (l *logger) With(keyvals ...interface{}) Logger {
 	newLogger := &logger{
-		formatter: l.formatter,
-		job:       l.job,
-		metadata:  copyMetadata(l.metadata),
-		sender:    l.sender,
-		labelKeys: l.labelKeys,
-		minLevel:  l.minLevel,
+		formatter:  l.formatter,
+		job:        l.job,
+		metadata:   copyMetadata(l.metadata),
+		sender:     l.sender,
+		labelKeys:  l.labelKeys,
+		minLevel:   l.minLevel,
+		tenant:     l.tenant,
+		metrics:    l.metrics,
+		extractors: l.extractors,
 	}
 
 	processKeyvals(newLogger.metadata, keyvals...)
@@ -85,12 +94,15 @@ func (l *logger) With(keyvals ...interface{}) Logger {
 
 func (l *logger) WithJob(job string) Logger {
 	return &logger{
-		formatter: l.formatter,
-		job:       job,
-		metadata:  copyMetadata(l.metadata),
-		sender:    l.sender,
-		labelKeys: l.labelKeys,
-		minLevel:  l.minLevel,
+		formatter:  l.formatter,
+		job:        job,
+		metadata:   copyMetadata(l.metadata),
+		sender:     l.sender,
+		labelKeys:  l.labelKeys,
+		minLevel:   l.minLevel,
+		tenant:     l.tenant,
+		metrics:    l.metrics,
+		extractors: l.extractors,
 	}
 }
 
@@ -128,15 +140,30 @@ func WithMinLevel(level int) Option {
 	}
 }
 
+func WithTenant(tenant string) Option {
+	return func(l *logger) {
+		l.tenant = tenant
+	}
+}
+
+// WithMetrics counts every entry passed to the sender, by level and job
+func WithMetrics(registry *metrics.Registry) Option {
+	return func(l *logger) {
+		l.metrics = registry
+	}
+}
+
 // log is the internal logging function
 func (l *logger) log(ctx context.Context, level string, message string, keyvals ...interface{}) error {
-	if levelVal, ok := levelValues[level]; ok && levelVal < l.minLevel {
+	levelVal, known := levelValues[level]
+	if known && levelVal < l.minLevel {
 		return nil
 	}
 
-	// Combine message, provided key-values, and default metadata
+	// Combine message, context fields, provided key-values, and default metadata
 	allKeyVals := make([]interface{}, 0, len(keyvals)+len(l.metadata)*2+2)
 	allKeyVals = append(allKeyVals, "message", message)
+	allKeyVals = append(allKeyVals, l.contextKeyvals(ctx)...)
 	allKeyVals = append(allKeyVals, keyvals...)
 	for k, v := range l.metadata {
 		allKeyVals = append(allKeyVals, k, v)
@@ -145,6 +172,11 @@ func (l *logger) log(ctx context.Context, level string, message string, keyvals
 	// Create log entry
 	entry := formatter.NewLogEntry(l.job, level, allKeyVals...)
 
+	return l.send(ctx, entry)
+}
+
+// send promotes label keys, formats the entry and passes it to the sender
+func (l *logger) send(ctx context.Context, entry formatter.LogEntry) error {
 	// Extract label values and remove from content
 	labels := map[string]string{
 		"job": l.job,
@@ -156,12 +188,29 @@ func (l *logger) log(ctx context.Context, level string, message string, keyvals
 		}
 	}
 
+	// Route to the context tenant, falling back to the logger's tenant
+	tenant := l.tenant
+	if ctxTenant, ok := TenantFromContext(ctx); ok {
+		tenant = ctxTenant
+	}
+	if tenant != "" {
+		labels[client.TenantLabel] = tenant
+	}
+
 	// Format content
 	content, err := l.formatter.Format(entry)
 	if err != nil {
 		return fmt.Errorf("%w: failed to format log entry: %v", errors.ErrInvalidFormat, err)
 	}
 
+	if levelVal, known := levelValues[entry.Level]; known {
+		ctx = ContextWithLevel(ctx, levelVal)
+	}
+
+	if l.metrics != nil {
+		l.metrics.ObserveEntry(entry.Level, l.job)
+	}
+
 	return l.sender.Send(ctx, content, labels, entry.Timestamp)
 }
 
@@ -3,9 +3,12 @@ package logger
 import (
 	"context"
 	"encoding/json"
+	"strings"
 	"testing"
 
+	"github.com/mwazovzky/cloudlog/client"
 	"github.com/mwazovzky/cloudlog/formatter"
+	"github.com/mwazovzky/cloudlog/metrics"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -132,3 +135,50 @@ func TestLogger_SendsLabels(t *testing.T) {
 
 	assert.Equal(t, "my-service", sender.labels[0]["job"])
 }
+
+func TestLogger_Tenant(t *testing.T) {
+	sender := &mockSender{}
+	log := New(sender, WithTenant("team-a"))
+
+	err := log.With("key", "value").Info(ctx, "from option")
+	assert.NoError(t, err)
+
+	err = log.Info(ContextWithTenant(ctx, "team-b"), "from context")
+	assert.NoError(t, err)
+
+	err = New(sender).Info(ctx, "no tenant")
+	assert.NoError(t, err)
+
+	require.Len(t, sender.labels, 3)
+	assert.Equal(t, "team-a", sender.labels[0][client.TenantLabel])
+	assert.Equal(t, "team-b", sender.labels[1][client.TenantLabel])
+	assert.NotContains(t, sender.labels[2], client.TenantLabel)
+}
+
+func TestLogger_LevelInContext(t *testing.T) {
+	sender := &mockSender{}
+	log := New(sender)
+
+	assert.NoError(t, log.Debug(ctx, "debug"))
+	assert.NoError(t, log.Info(ctx, "info"))
+	assert.NoError(t, log.Warn(ctx, "warn"))
+	assert.NoError(t, log.Error(ctx, "error"))
+
+	assert.Equal(t, []int{LevelDebug, LevelInfo, LevelWarn, LevelError}, sender.levels)
+}
+
+func TestLogger_Metrics(t *testing.T) {
+	registry := metrics.NewRegistry()
+	log := New(&mockSender{}, WithJob("api"), WithMetrics(registry), WithMinLevel(LevelInfo))
+
+	require.NoError(t, log.Info(ctx, "one"))
+	require.NoError(t, log.Debug(ctx, "filtered"))
+	require.NoError(t, log.WithJob("worker").Error(ctx, "two"))
+	require.NoError(t, log.With("k", "v").Info(ctx, "three"))
+
+	var out strings.Builder
+	require.NoError(t, registry.Write(&out))
+	assert.Contains(t, out.String(), `cloudlog_entries_total{job="api",level="info"} 2`)
+	assert.Contains(t, out.String(), `cloudlog_entries_total{job="worker",level="error"} 1`)
+	assert.NotContains(t, out.String(), `level="debug"`)
+}
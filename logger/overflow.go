@@ -0,0 +1,337 @@
+package logger
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/mwazovzky/cloudlog/errors"
+)
+
+// OverflowPolicy selects what Send does when the AsyncSender buffer is full
+type OverflowPolicy int
+
+const (
+	// OverflowReject returns ErrBufferFull (default)
+	OverflowReject OverflowPolicy = iota
+	// OverflowBlock waits until the buffer has room or the sender is closed
+	OverflowBlock
+	// OverflowBlockTimeout waits up to OverflowConfig.Timeout, then returns ErrBufferFull
+	OverflowBlockTimeout
+	// OverflowDropOldest discards the oldest buffered entry to make room
+	OverflowDropOldest
+	// OverflowSample keeps every warn and error entry and, once the buffer is
+	// filled beyond OverflowConfig.SampleThreshold, only one in SampleRate
+	// debug and info entries
+	OverflowSample
+)
+
+// OverflowConfig configures how the AsyncSender handles a full buffer
+type OverflowConfig struct {
+	Policy OverflowPolicy
+	// Timeout bounds the wait of OverflowBlockTimeout (default 100ms)
+	Timeout time.Duration
+	// SampleThreshold is the buffer fill ratio (0..1) at which OverflowSample
+	// starts thinning debug and info entries (default 0.8)
+	SampleThreshold float64
+	// SampleRate keeps one in SampleRate debug and info entries under pressure (default 10)
+	SampleRate int
+}
+
+const (
+	defaultOverflowTimeout = 100 * time.Millisecond
+	defaultSampleThreshold = 0.8
+	defaultSampleRate      = 10
+)
+
+// OverflowStats counts the outcomes of overflow handling
+type OverflowStats struct {
+	// Rejected is the number of entries refused with ErrBufferFull, including timeouts
+	Rejected uint64
+	// Blocked is the number of Send calls that had to wait for buffer space
+	Blocked uint64
+	// TimedOut is the number of Send calls that gave up waiting (OverflowBlockTimeout)
+	TimedOut uint64
+	// DroppedOldest is the number of buffered entries discarded to make room:
+	// the oldest ones with OverflowDropOldest, the oldest debug and info ones
+	// for warn and error entries with OverflowSample
+	DroppedOldest uint64
+	// SampledOut is the number of debug and info entries discarded by OverflowSample
+	SampledOut uint64
+}
+
+// overflowCounters holds the live counters behind OverflowStats
+type overflowCounters struct {
+	rejected      atomic.Uint64
+	blocked       atomic.Uint64
+	timedOut      atomic.Uint64
+	droppedOldest atomic.Uint64
+	sampledOut    atomic.Uint64
+	sampleSeq     atomic.Uint64
+}
+
+// OverflowStats returns a snapshot of the overflow counters
+func (s *AsyncSender) OverflowStats() OverflowStats {
+	return OverflowStats{
+		Rejected:      s.overflowCounters.rejected.Load(),
+		Blocked:       s.overflowCounters.blocked.Load(),
+		TimedOut:      s.overflowCounters.timedOut.Load(),
+		DroppedOldest: s.overflowCounters.droppedOldest.Load(),
+		SampledOut:    s.overflowCounters.sampledOut.Load(),
+	}
+}
+
+// enqueue pushes an entry into the buffer according to the overflow policy.
+// With WithMaxBufferBytes, the entry's bytes are reserved before it takes a
+// buffer slot, so concurrent senders never exceed the byte limit.
+func (s *AsyncSender) enqueue(w *worker, e entry) error {
+	wait := &waitTimer{}
+	if s.overflow.Policy == OverflowBlockTimeout {
+		wait.timeout = s.overflow.Timeout
+	}
+	defer wait.stop()
+
+	err := s.reserveBytes(w, e, wait)
+	if err == nil {
+		err = w.enqueue(e, wait)
+		if err != nil && s.budget != nil {
+			s.budget.release(e.size)
+		}
+	}
+
+	if wait.waited {
+		s.overflowCounters.blocked.Add(1)
+	}
+	return err
+}
+
+// reserveBytes claims the entry's bytes from the buffer byte budget
+func (s *AsyncSender) reserveBytes(w *worker, e entry, wait *waitTimer) error {
+	if s.budget == nil || s.budget.reserve(e.size) {
+		return nil
+	}
+
+	switch s.overflow.Policy {
+	case OverflowBlock, OverflowBlockTimeout:
+		for {
+			freed := s.budget.released()
+			if s.budget.reserve(e.size) {
+				return nil
+			}
+			select {
+			case <-freed:
+			case <-s.done:
+				return errors.ErrSenderClosed
+			case <-wait.C():
+				return s.timedOut()
+			}
+		}
+
+	case OverflowDropOldest:
+		return s.reserveDropOldest(w, e)
+
+	case OverflowSample:
+		if e.level >= LevelWarn {
+			for !s.budget.reserve(e.size) {
+				if !w.dropLowLevel() {
+					return s.rejected()
+				}
+			}
+			return nil
+		}
+	}
+
+	return s.rejected()
+}
+
+// reserveDropOldest discards entries from the worker's buffer until the entry's
+// bytes fit. Bytes of entries already taken by a worker, or buffered by another
+// worker, are not reclaimed.
+func (s *AsyncSender) reserveDropOldest(w *worker, e entry) error {
+	for !s.budget.reserve(e.size) {
+		if !w.dropOldest() {
+			return s.rejected()
+		}
+	}
+	return nil
+}
+
+// enqueue puts the entry into the worker's priority lane or buffer
+func (w *worker) enqueue(e entry, wait *waitTimer) error {
+	if w.priority != nil && e.level >= w.s.priorityLevel {
+		select {
+		case w.priority <- e:
+			return nil
+		default:
+		}
+	}
+
+	if w.tryBuffer(e) {
+		return nil
+	}
+
+	switch w.s.overflow.Policy {
+	case OverflowBlock, OverflowBlockTimeout:
+		return w.enqueueWait(e, wait)
+
+	case OverflowDropOldest:
+		return w.enqueueDropOldest(e)
+
+	case OverflowSample:
+		if e.level >= LevelWarn {
+			return w.enqueueDropLowLevel(e)
+		}
+	}
+
+	return w.s.rejected()
+}
+
+// tryBuffer puts the entry into the buffer if it has room
+func (w *worker) tryBuffer(e entry) bool {
+	w.admit.RLock()
+	defer w.admit.RUnlock()
+
+	select {
+	case w.buffer <- e:
+		return true
+	default:
+		return false
+	}
+}
+
+// sampled reports whether OverflowSample discards a debug or info entry
+// because the buffer is under pressure
+func (s *AsyncSender) sampled(w *worker, e entry) bool {
+	if s.overflow.Policy != OverflowSample || e.level >= LevelWarn {
+		return false
+	}
+	fill := float64(len(w.buffer)) / float64(cap(w.buffer))
+	if s.budget != nil {
+		fill = max(fill, s.budget.fill())
+	}
+	if fill < s.overflow.SampleThreshold {
+		return false
+	}
+	if s.overflowCounters.sampleSeq.Add(1)%uint64(s.overflow.SampleRate) == 0 {
+		return false
+	}
+	s.overflowCounters.sampledOut.Add(1)
+	return true
+}
+
+// enqueueWait blocks until the entry is buffered, the sender is closed or the wait times out
+func (w *worker) enqueueWait(e entry, wait *waitTimer) error {
+	select {
+	case w.buffer <- e:
+		return nil
+	case <-w.s.done:
+		return errors.ErrSenderClosed
+	case <-wait.C():
+		return w.s.timedOut()
+	}
+}
+
+// enqueueDropOldest discards buffered entries from the front until the entry fits
+func (w *worker) enqueueDropOldest(e entry) error {
+	for {
+		select {
+		case w.buffer <- e:
+			return nil
+		default:
+		}
+		w.dropOldest()
+	}
+}
+
+// dropOldest discards the entry at the front of the buffer, reporting false if
+// the buffer is empty. Flush markers are never discarded; they are put back at
+// the end of the buffer.
+func (w *worker) dropOldest() bool {
+	select {
+	case old := <-w.buffer:
+		if old.flushCh != nil {
+			if err := w.enqueueWait(old, &waitTimer{}); err != nil {
+				close(old.flushCh)
+			}
+			return true
+		}
+		w.discard(old)
+		return true
+	default:
+		return false
+	}
+}
+
+// enqueueDropLowLevel makes room for a warn or error entry by discarding
+// debug and info entries, oldest first. The entry is rejected only when the
+// buffer holds nothing else than warn and error entries.
+func (w *worker) enqueueDropLowLevel(e entry) error {
+	for !w.tryBuffer(e) {
+		if !w.dropLowLevel() {
+			return w.s.rejected()
+		}
+	}
+	return nil
+}
+
+// dropLowLevel discards the oldest debug or info entry in the buffer, keeping
+// the other entries in order, and reports false if there is none. The buffer
+// is emptied and refilled meanwhile, so new entries are held off by admit.
+func (w *worker) dropLowLevel() bool {
+	w.admit.Lock()
+	defer w.admit.Unlock()
+
+	var kept []entry
+	dropped := false
+take:
+	for n := len(w.buffer); n > 0; n-- {
+		select {
+		case old := <-w.buffer:
+			if !dropped && old.flushCh == nil && old.level < LevelWarn {
+				w.discard(old)
+				dropped = true
+				continue
+			}
+			kept = append(kept, old)
+		default:
+			break take // the worker took the remaining entries
+		}
+	}
+
+	for _, old := range kept {
+		select {
+		case w.buffer <- old:
+		case <-w.s.done:
+			if old.flushCh != nil {
+				close(old.flushCh)
+			} else {
+				w.discard(old)
+			}
+		}
+	}
+	return dropped
+}
+
+// discard accounts for a buffered entry dropped to make room
+func (w *worker) discard(old entry) {
+	s := w.s
+	s.overflowCounters.droppedOldest.Add(1)
+	s.pending.Add(-1)
+	if old.segment != nil {
+		s.spool.ack(old.segment)
+	}
+	if s.budget != nil {
+		s.budget.release(old.size)
+	}
+}
+
+// rejected counts an entry refused with ErrBufferFull
+func (s *AsyncSender) rejected() error {
+	s.overflowCounters.rejected.Add(1)
+	return errors.ErrBufferFull
+}
+
+// timedOut counts an entry refused after waiting for OverflowConfig.Timeout
+func (s *AsyncSender) timedOut() error {
+	s.overflowCounters.timedOut.Add(1)
+	return s.rejected()
+}
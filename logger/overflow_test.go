@@ -0,0 +1,240 @@
+package logger
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/mwazovzky/cloudlog/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stalledSender returns an AsyncSender whose worker has taken one entry and is
+// blocked sending it until the returned release function is called
+func stalledSender(t *testing.T, mock *asyncMockLogSender, options ...AsyncSenderOption) (*AsyncSender, func()) {
+	blockCh := make(chan struct{})
+	options = append([]AsyncSenderOption{WithBatchSize(1), WithFlushInterval(time.Hour)}, options...)
+	sender := NewAsyncSender(&blockingLogSender{ch: blockCh, delegate: mock}, options...)
+
+	require.NoError(t, sender.Send(ctx, []byte("first"), map[string]string{"job": "test"}, time.Now()))
+	require.Eventually(t, func() bool { return len(sender.workers[0].buffer) == 0 }, time.Second, time.Millisecond)
+
+	return sender, func() { close(blockCh) }
+}
+
+func sentContents(mock *asyncMockLogSender) []string {
+	var contents []string
+	for _, e := range mock.getEntries() {
+		for _, s := range e.Streams {
+			for _, v := range s.Values {
+				contents = append(contents, v[1])
+			}
+		}
+	}
+	return contents
+}
+
+func TestAsyncSender_OverflowDropOldest(t *testing.T) {
+	mock := &asyncMockLogSender{}
+	sender, release := stalledSender(t, mock,
+		WithBufferSize(2),
+		WithOverflow(OverflowConfig{Policy: OverflowDropOldest}),
+	)
+
+	labels := map[string]string{"job": "test"}
+	for _, content := range []string{"a", "b", "c", "d"} {
+		assert.NoError(t, sender.Send(ctx, []byte(content), labels, time.Now()))
+	}
+
+	release()
+	sender.Close()
+
+	assert.Equal(t, []string{"first", "c", "d"}, sentContents(mock))
+	assert.Equal(t, OverflowStats{DroppedOldest: 2}, sender.OverflowStats())
+}
+
+func TestAsyncSender_OverflowBlockTimeout(t *testing.T) {
+	mock := &asyncMockLogSender{}
+	sender, release := stalledSender(t, mock,
+		WithBufferSize(1),
+		WithOverflow(OverflowConfig{Policy: OverflowBlockTimeout, Timeout: 20 * time.Millisecond}),
+	)
+	defer func() {
+		release()
+		sender.Close()
+	}()
+
+	labels := map[string]string{"job": "test"}
+	require.NoError(t, sender.Send(ctx, []byte("a"), labels, time.Now()))
+
+	start := time.Now()
+	err := sender.Send(ctx, []byte("b"), labels, time.Now())
+	assert.ErrorIs(t, err, errors.ErrBufferFull)
+	assert.GreaterOrEqual(t, time.Since(start), 20*time.Millisecond)
+
+	assert.Equal(t, OverflowStats{Rejected: 1, Blocked: 1, TimedOut: 1}, sender.OverflowStats())
+}
+
+func TestAsyncSender_OverflowSample(t *testing.T) {
+	mock := &asyncMockLogSender{}
+	sender, release := stalledSender(t, mock,
+		WithBufferSize(4),
+		WithOverflow(OverflowConfig{Policy: OverflowSample, SampleThreshold: 0.5, SampleRate: 2}),
+	)
+
+	labels := map[string]string{"job": "test"}
+	info := ContextWithLevel(ctx, LevelInfo)
+
+	// i1 and i2 fill the buffer to the threshold; from then on every second info entry is kept
+	for i := 1; i <= 7; i++ {
+		assert.NoError(t, sender.Send(info, []byte(fmt.Sprintf("i%d", i)), labels, time.Now()))
+	}
+
+	// The buffer is full: a sampled-in info entry is rejected, an error evicts the oldest info entry
+	assert.ErrorIs(t, sender.Send(info, []byte("i8"), labels, time.Now()), errors.ErrBufferFull)
+	assert.NoError(t, sender.Send(ContextWithLevel(ctx, LevelError), []byte("e1"), labels, time.Now()))
+
+	release()
+	sender.Close()
+
+	assert.Equal(t, []string{"first", "i2", "i4", "i6", "e1"}, sentContents(mock))
+	assert.Equal(t, OverflowStats{Rejected: 1, DroppedOldest: 1, SampledOut: 3}, sender.OverflowStats())
+}
+
+func TestAsyncSender_OverflowSampleKeepsErrors(t *testing.T) {
+	mock := &asyncMockLogSender{}
+	sender, release := stalledSender(t, mock,
+		WithBufferSize(3),
+		WithOverflow(OverflowConfig{Policy: OverflowSample, SampleThreshold: 1}),
+	)
+
+	labels := map[string]string{"job": "test"}
+	info := ContextWithLevel(ctx, LevelInfo)
+	errorCtx := ContextWithLevel(ctx, LevelError)
+
+	// The buffer is full, with an error at its head
+	require.NoError(t, sender.Send(errorCtx, []byte("e1"), labels, time.Now()))
+	require.NoError(t, sender.Send(info, []byte("i1"), labels, time.Now()))
+	require.NoError(t, sender.Send(info, []byte("i2"), labels, time.Now()))
+
+	// New errors evict the info entries, never the older error
+	assert.NoError(t, sender.Send(errorCtx, []byte("e2"), labels, time.Now()))
+	assert.NoError(t, sender.Send(errorCtx, []byte("e3"), labels, time.Now()))
+
+	// With nothing but errors left, the new one is rejected
+	assert.ErrorIs(t, sender.Send(errorCtx, []byte("e4"), labels, time.Now()), errors.ErrBufferFull)
+
+	release()
+	sender.Close()
+
+	assert.Equal(t, []string{"first", "e1", "e2", "e3"}, sentContents(mock))
+	assert.Equal(t, OverflowStats{Rejected: 1, DroppedOldest: 2}, sender.OverflowStats())
+}
+
+func TestAsyncSender_PriorityLaneSentFirst(t *testing.T) {
+	mock := &asyncMockLogSender{}
+	sender, release := stalledSender(t, mock,
+		WithBufferSize(10),
+		WithPriorityLane(LevelWarn, 0.2),
+	)
+
+	labels := map[string]string{"job": "test"}
+	require.NoError(t, sender.Send(ContextWithLevel(ctx, LevelInfo), []byte("a"), labels, time.Now()))
+	require.NoError(t, sender.Send(ctx, []byte("b"), labels, time.Now()))
+	require.NoError(t, sender.Send(ContextWithLevel(ctx, LevelError), []byte("e"), labels, time.Now()))
+
+	release()
+	sender.Close()
+
+	// Older entries of the same stream are not overtaken
+	assert.Equal(t, []string{"first", "a", "b", "e"}, sentContents(mock))
+}
+
+func TestAsyncSender_PriorityLaneOvertakesOtherStreams(t *testing.T) {
+	mock := &asyncMockLogSender{}
+	sender, release := stalledSender(t, mock,
+		WithBufferSize(10),
+		WithPriorityLane(LevelWarn, 0.2),
+	)
+
+	info := ContextWithLevel(ctx, LevelInfo)
+	other := map[string]string{"job": "other"}
+	app := map[string]string{"job": "app"}
+	require.NoError(t, sender.Send(info, []byte("o1"), other, time.Now()))
+	require.NoError(t, sender.Send(info, []byte("a1"), app, time.Now()))
+	require.NoError(t, sender.Send(info, []byte("o2"), other, time.Now()))
+	require.NoError(t, sender.Send(ContextWithLevel(ctx, LevelError), []byte("e"), app, time.Now()))
+
+	release()
+	sender.Close()
+
+	// Only the older entry of the error's own stream is sent before it
+	assert.Equal(t, []string{"first", "a1", "e", "o1", "o2"}, sentContents(mock))
+}
+
+func TestAsyncSender_PriorityLaneSendsOlderEntriesWithoutDelay(t *testing.T) {
+	mock := &asyncMockLogSender{}
+	sender := NewAsyncSender(mock,
+		WithBufferSize(100),
+		WithFlushInterval(time.Hour),
+		WithPriorityLane(LevelWarn, 0.2),
+	)
+	defer sender.Close()
+
+	labels := map[string]string{"job": "a"}
+	info := ContextWithLevel(ctx, LevelInfo)
+	var want []string
+	for i := 1; i <= 20; i++ {
+		content := fmt.Sprintf("i%d", i)
+		require.NoError(t, sender.Send(info, []byte(content), labels, time.Now()))
+		want = append(want, content)
+	}
+	require.NoError(t, sender.Send(ContextWithLevel(ctx, LevelError), []byte("e21"), labels, time.Now()))
+	want = append(want, "e21")
+
+	// The error is sent at once, together with the info entries buffered before it
+	require.Eventually(t, func() bool { return mock.totalValues() == 21 }, time.Second, time.Millisecond)
+	assert.Equal(t, want, sentContents(mock))
+}
+
+func TestAsyncSender_PriorityLaneReservesCapacity(t *testing.T) {
+	mock := &asyncMockLogSender{}
+	sender, release := stalledSender(t, mock,
+		WithBufferSize(4),
+		WithPriorityLane(LevelWarn, 0.5),
+	)
+	defer func() {
+		release()
+		sender.Close()
+	}()
+
+	labels := map[string]string{"job": "test"}
+	info := ContextWithLevel(ctx, LevelInfo)
+	warn := ContextWithLevel(ctx, LevelWarn)
+
+	assert.NoError(t, sender.Send(info, []byte("i1"), labels, time.Now()))
+	assert.NoError(t, sender.Send(info, []byte("i2"), labels, time.Now()))
+	assert.ErrorIs(t, sender.Send(info, []byte("i3"), labels, time.Now()), errors.ErrBufferFull)
+
+	// Info entries cannot take the reserved share
+	assert.NoError(t, sender.Send(warn, []byte("w1"), labels, time.Now()))
+	assert.NoError(t, sender.Send(warn, []byte("w2"), labels, time.Now()))
+	assert.ErrorIs(t, sender.Send(warn, []byte("w3"), labels, time.Now()), errors.ErrBufferFull)
+}
+
+func TestAsyncSender_PriorityLaneKeepsStreamOrderInBatch(t *testing.T) {
+	mock := &asyncMockLogSender{}
+	sender := NewAsyncSender(mock, WithPriorityLane(LevelWarn, 0.5))
+	defer sender.Close()
+
+	// The priority entry was taken from its lane ahead of an older entry of the same stream
+	labels := map[string]string{"job": "test"}
+	now := time.Now()
+	sender.workers[0].sendBatch([]entry{
+		{content: []byte("error"), labels: labels, timestamp: now.Add(time.Millisecond), level: LevelError},
+		{content: []byte("info"), labels: labels, timestamp: now, level: LevelInfo},
+	})
+
+	assert.Equal(t, []string{"info", "error"}, sentContents(mock))
+}
@@ -0,0 +1,53 @@
+package logger
+
+import (
+	stderrors "errors"
+	"maps"
+	"strconv"
+	"time"
+
+	"github.com/mwazovzky/cloudlog/client"
+	"github.com/mwazovzky/cloudlog/errors"
+)
+
+// rejectedEntries matches the per-stream rejections carried by a send error
+// against the entries of the failed push. Rejections that name a stream match
+// the entry with the reported timestamp or line size, or every entry of the
+// stream if neither is reported. Rejections without a stream are not matched.
+func rejectedEntries(lokiEntry client.LokiEntry, err error) []errors.RejectedEntry {
+	var sendErr *errors.SendError
+	if !stderrors.As(err, &sendErr) || len(sendErr.Rejections) == 0 {
+		return nil
+	}
+
+	var rejected []errors.RejectedEntry
+	for _, stream := range lokiEntry.Streams {
+		for _, value := range stream.Values {
+			ns, _ := strconv.ParseInt(value[0], 10, 64)
+			timestamp := time.Unix(0, ns)
+
+			for _, r := range sendErr.Rejections {
+				if r.Stream == nil || !maps.Equal(r.Stream, stream.Stream) {
+					continue
+				}
+				if !r.Timestamp.IsZero() && !r.Timestamp.Equal(timestamp) {
+					continue
+				}
+				if r.LineSize > 0 && r.LineSize != len(value[1]) {
+					continue
+				}
+
+				rejected = append(rejected, errors.RejectedEntry{
+					Labels:    stream.Stream,
+					Timestamp: timestamp,
+					Content:   []byte(value[1]),
+					Reason:    r.Reason,
+					Message:   r.Message,
+				})
+				break
+			}
+		}
+	}
+
+	return rejected
+}
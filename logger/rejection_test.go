@@ -0,0 +1,54 @@
+package logger
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/mwazovzky/cloudlog/client"
+	"github.com/mwazovzky/cloudlog/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRejectedEntries(t *testing.T) {
+	ts := time.Date(2024, 1, 2, 10, 0, 0, 0, time.UTC)
+	lokiEntry := client.LokiEntry{
+		Streams: []client.LokiStream{
+			{
+				Stream: map[string]string{"job": "api"},
+				Values: [][]string{
+					{fmt.Sprintf("%d", ts.UnixNano()), "first"},
+					{fmt.Sprintf("%d", ts.Add(time.Second).UnixNano()), "second"},
+				},
+			},
+			{
+				Stream: map[string]string{"job": "batch"},
+				Values: [][]string{{fmt.Sprintf("%d", ts.UnixNano()), "0123456789"}, {fmt.Sprintf("%d", ts.UnixNano()), "short"}},
+			},
+			{
+				Stream: map[string]string{"job": "worker"},
+				Values: [][]string{{fmt.Sprintf("%d", ts.UnixNano()), "untouched"}},
+			},
+		},
+	}
+
+	err := &errors.SendError{
+		Err: errors.ErrResponseError,
+		Rejections: []errors.Rejection{
+			{Stream: map[string]string{"job": "api"}, Timestamp: ts.Add(time.Second), Reason: errors.ReasonOutOfOrder},
+			{Stream: map[string]string{"job": "batch"}, LineSize: 10, Reason: errors.ReasonLineTooLong},
+			{Reason: errors.ReasonStreamLimit},
+		},
+	}
+
+	rejected := rejectedEntries(lokiEntry, fmt.Errorf("wrapped: %w", err))
+	require.Len(t, rejected, 2)
+
+	assert.Equal(t, "second", string(rejected[0].Content))
+	assert.Equal(t, errors.ReasonOutOfOrder, rejected[0].Reason)
+	assert.Equal(t, "0123456789", string(rejected[1].Content))
+	assert.Equal(t, errors.ReasonLineTooLong, rejected[1].Reason)
+
+	assert.Nil(t, rejectedEntries(lokiEntry, errors.ErrResponseError))
+}
@@ -0,0 +1,272 @@
+package logger
+
+import (
+	stderrors "errors"
+	"time"
+
+	"github.com/mwazovzky/cloudlog/client"
+	"github.com/mwazovzky/cloudlog/errors"
+)
+
+// RetryOverflow selects what the retry queue discards when it is full
+type RetryOverflow int
+
+const (
+	// RetryDropOldest discards the oldest queued batches to make room (default)
+	RetryDropOldest RetryOverflow = iota
+	// RetryDropNewest discards the failed batch that does not fit
+	RetryDropNewest
+)
+
+// RetryQueueConfig configures the AsyncSender retry queue for failed pushes.
+// Each worker has its own queue with these limits.
+type RetryQueueConfig struct {
+	// MaxBatches caps the number of queued pushes (default 100)
+	MaxBatches int
+	// MaxBytes caps the estimated size of all queued pushes (default 32MB)
+	MaxBytes int
+	// MaxAttempts limits the attempts per push; zero retries until the push
+	// is displaced by the overflow policy
+	MaxAttempts int
+	// BaseDelay is the delay before the first retry; it doubles on each retry (default 1s)
+	BaseDelay time.Duration
+	// MaxDelay caps the delay between two retries (default 1m)
+	MaxDelay time.Duration
+	// Overflow selects what is discarded when the queue is full
+	Overflow RetryOverflow
+}
+
+const (
+	defaultRetryQueueBatches = 100
+	defaultRetryQueueBytes   = 32 << 20
+	defaultRetryBaseDelay    = time.Second
+	defaultRetryMaxDelay     = time.Minute
+)
+
+// failedPush is a push waiting in the retry queue
+type failedPush struct {
+	entry    client.LokiEntry
+	size     int
+	attempts int
+	retryAt  time.Time
+	err      error
+	release  *batchRelease
+}
+
+// retryQueue holds failed pushes in FIFO order. It is owned by the worker
+// goroutine and needs no locking.
+type retryQueue struct {
+	config RetryQueueConfig
+	policy client.RetryPolicy
+	items  []*failedPush
+	bytes  int
+	timer  *time.Timer
+}
+
+func newRetryQueue(cfg RetryQueueConfig) *retryQueue {
+	if cfg.MaxBatches <= 0 {
+		cfg.MaxBatches = defaultRetryQueueBatches
+	}
+	if cfg.MaxBytes <= 0 {
+		cfg.MaxBytes = defaultRetryQueueBytes
+	}
+	if cfg.BaseDelay <= 0 {
+		cfg.BaseDelay = defaultRetryBaseDelay
+	}
+	if cfg.MaxDelay <= 0 {
+		cfg.MaxDelay = defaultRetryMaxDelay
+	}
+
+	timer := time.NewTimer(time.Hour)
+	timer.Stop()
+
+	return &retryQueue{
+		config: cfg,
+		policy: client.RetryPolicy{BaseDelay: cfg.BaseDelay, MaxDelay: cfg.MaxDelay, Jitter: 0.2},
+		timer:  timer,
+	}
+}
+
+// push appends a failed push, returning the pushes displaced by the overflow policy
+func (q *retryQueue) push(p *failedPush) []*failedPush {
+	var dropped []*failedPush
+	for len(q.items) > 0 && (len(q.items) >= q.config.MaxBatches || q.bytes+p.size > q.config.MaxBytes) {
+		if q.config.Overflow == RetryDropNewest {
+			return []*failedPush{p}
+		}
+		dropped = append(dropped, q.pop())
+	}
+
+	q.items = append(q.items, p)
+	q.bytes += p.size
+	q.schedule()
+	return dropped
+}
+
+// front returns the oldest queued push, nil if the queue is empty
+func (q *retryQueue) front() *failedPush {
+	if len(q.items) == 0 {
+		return nil
+	}
+	return q.items[0]
+}
+
+// pop removes the oldest queued push
+func (q *retryQueue) pop() *failedPush {
+	p := q.items[0]
+	q.items[0] = nil
+	q.items = q.items[1:]
+	q.bytes -= p.size
+	q.schedule()
+	return p
+}
+
+// failed records another failed attempt of the oldest push and schedules its retry.
+// It reports false when the push has used up its attempts.
+func (q *retryQueue) failed(p *failedPush, err error) bool {
+	p.attempts++
+	p.err = err
+	if q.config.MaxAttempts > 0 && p.attempts >= q.config.MaxAttempts {
+		return false
+	}
+	p.retryAt = time.Now().Add(q.policy.Backoff(p.attempts))
+	q.schedule()
+	return true
+}
+
+// schedule arms the timer for the oldest push's retry
+func (q *retryQueue) schedule() {
+	q.timer.Stop()
+	if p := q.front(); p != nil {
+		q.timer.Reset(time.Until(p.retryAt))
+	}
+}
+
+// ready returns the timer channel, nil when nothing is queued
+func (q *retryQueue) ready() <-chan time.Time {
+	if q == nil || len(q.items) == 0 {
+		return nil
+	}
+	return q.timer.C
+}
+
+// isRetryable reports whether a push failure is transient and worth queueing
+func isRetryable(err error) bool {
+	var sendErr *errors.SendError
+	if stderrors.As(err, &sendErr) {
+		return sendErr.Retryable
+	}
+	return errors.IsConnectionError(err)
+}
+
+// dispatch delivers a push, queueing it for retry when it fails transiently.
+// While earlier pushes wait in the retry queue, new pushes are queued behind
+// them so streams stay in timestamp order.
+func (w *worker) dispatch(lokiEntry client.LokiEntry, release *batchRelease) {
+	s := w.s
+	if s.aborted() {
+		s.abandon(lokiEntry, release, nil)
+		return
+	}
+
+	if w.retryQueue != nil {
+		if head := w.retryQueue.front(); head != nil {
+			w.requeue(&failedPush{entry: lokiEntry, size: entrySize(lokiEntry), err: head.err, release: release})
+			return
+		}
+	}
+
+	err := s.deliver(lokiEntry)
+	if err == nil {
+		release.release(true)
+		return
+	}
+
+	if s.aborted() {
+		s.abandon(lokiEntry, release, err)
+		return
+	}
+
+	if w.retryQueue != nil && isRetryable(err) {
+		p := &failedPush{entry: lokiEntry, size: entrySize(lokiEntry), release: release}
+		if w.retryQueue.failed(p, err) {
+			w.requeue(p)
+		} else {
+			s.drop(p, "retry attempts exhausted")
+			release.release(false)
+		}
+		return
+	}
+
+	// Entries rejected by Loki are done with; after a transient failure their
+	// spool records are kept for the next start
+	s.report(lokiEntry, err)
+	release.release(!isRetryable(err))
+}
+
+// requeue adds a push to the retry queue, reporting any pushes it displaces
+func (w *worker) requeue(p *failedPush) {
+	if p.retryAt.IsZero() {
+		p.retryAt = time.Now()
+	}
+	for _, dropped := range w.retryQueue.push(p) {
+		w.s.drop(dropped, "retry queue full")
+		dropped.release.release(false)
+	}
+}
+
+// retry resends queued pushes in order, stopping at the first push that is
+// not yet due or fails again. With force, the oldest push is retried at once.
+func (w *worker) retry(force bool) {
+	s := w.s
+	for p := w.retryQueue.front(); p != nil; p = w.retryQueue.front() {
+		if s.aborted() || (!force && time.Now().Before(p.retryAt)) {
+			return
+		}
+		force = false
+
+		s.stats.retried.Add(uint64(entryCount(p.entry)))
+		err := s.deliver(p.entry)
+		if err == nil {
+			w.retryQueue.pop()
+			p.release.release(true)
+			continue
+		}
+
+		if !isRetryable(err) {
+			w.retryQueue.pop()
+			s.report(p.entry, err)
+			p.release.release(true)
+			continue
+		}
+
+		if !w.retryQueue.failed(p, err) {
+			w.retryQueue.pop()
+			s.drop(p, "retry attempts exhausted")
+			p.release.release(false)
+			continue
+		}
+		return
+	}
+}
+
+// retryNow retries queued pushes immediately, so Flush does not wait for backoff
+func (w *worker) retryNow() {
+	if w.retryQueue != nil {
+		w.retry(true)
+	}
+}
+
+// abandonRetries gives up on the pushes still queued at shutdown
+func (w *worker) abandonRetries() {
+	for w.retryQueue.front() != nil {
+		p := w.retryQueue.pop()
+		w.s.abandon(p.entry, p.release, p.err)
+	}
+}
+
+// drop reports a discarded push to the error handler
+func (s *AsyncSender) drop(p *failedPush, reason string) {
+	s.stats.failed.Add(uint64(entryCount(p.entry)))
+	s.errorHandler(&errors.DroppedError{Entries: entryCount(p.entry), Reason: reason, Err: p.err})
+}
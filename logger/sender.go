@@ -20,10 +20,12 @@ func NewSyncSender(client client.LogSender) *SyncSender {
 
 // Send builds a LokiEntry from the formatted content and sends it immediately
 func (s *SyncSender) Send(ctx context.Context, content []byte, labels map[string]string, timestamp time.Time) error {
+	stream, tenant := splitTenant(labels)
 	entry := client.LokiEntry{
+		Tenant: tenant,
 		Streams: []client.LokiStream{
 			{
-				Stream: labels,
+				Stream: stream,
 				Values: [][]string{
 					{
 						fmt.Sprintf("%d", timestamp.UnixNano()),
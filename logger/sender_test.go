@@ -59,3 +59,17 @@ func TestSyncSender_PropagatesError(t *testing.T) {
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "send failed")
 }
+
+func TestSyncSender_Tenant(t *testing.T) {
+	mock := &mockLogSender{}
+	sender := NewSyncSender(mock)
+
+	labels := map[string]string{"job": "test-job", client.TenantLabel: "team-a"}
+	err := sender.Send(context.Background(), []byte("content"), labels, time.Now())
+	assert.NoError(t, err)
+
+	require.Len(t, mock.entries, 1)
+	assert.Equal(t, "team-a", mock.entries[0].Tenant)
+	assert.Equal(t, map[string]string{"job": "test-job"}, mock.entries[0].Streams[0].Stream)
+	assert.Contains(t, labels, client.TenantLabel, "caller labels must not be modified")
+}
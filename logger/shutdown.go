@@ -0,0 +1,172 @@
+package logger
+
+import (
+	"context"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/mwazovzky/cloudlog/client"
+	"github.com/mwazovzky/cloudlog/errors"
+)
+
+// shutdownCounters tracks entries the sender gave up on when it was closed
+type shutdownCounters struct {
+	undelivered atomic.Int64
+	spooled     atomic.Int64
+	fallback    atomic.Int64
+}
+
+// FlushContext blocks until all buffered entries have been sent or ctx is done.
+// If ctx ends first, it returns an *errors.UndeliveredError wrapping ctx.Err()
+// with the number of entries still pending; they stay buffered.
+func (s *AsyncSender) FlushContext(ctx context.Context) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.mu.Unlock()
+
+	flushChs := make([]chan struct{}, 0, len(s.workers))
+	for _, w := range s.workers {
+		flushCh := make(chan struct{})
+		select {
+		case w.buffer <- entry{flushCh: flushCh}:
+			flushChs = append(flushChs, flushCh)
+		case <-s.done:
+			return nil
+		case <-ctx.Done():
+			return s.pendingError(ctx.Err())
+		}
+	}
+
+	for _, flushCh := range flushChs {
+		select {
+		case <-flushCh:
+		case <-s.done:
+			return nil
+		case <-ctx.Done():
+			return s.pendingError(ctx.Err())
+		}
+	}
+	return nil
+}
+
+// Shutdown flushes remaining entries and stops the background workers, giving
+// up when ctx is done: in-flight pushes are cancelled and entries not yet
+// delivered are left in the spool or handed to the fallback sender (see
+// WithFallback). It returns an *errors.UndeliveredError if any entries were
+// not delivered. Calls after the first return nil.
+func (s *AsyncSender) Shutdown(ctx context.Context) error {
+	var err error
+	s.closeOnce.Do(func() {
+		err = s.shutdown(ctx)
+	})
+	return err
+}
+
+func (s *AsyncSender) shutdown(ctx context.Context) error {
+	_ = s.FlushContext(ctx)
+
+	s.mu.Lock()
+	s.closed = true
+	s.mu.Unlock()
+
+	close(s.done)
+
+	stopped := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		s.abortSends()
+		<-stopped
+	}
+
+	if s.spool != nil {
+		s.spool.close()
+	}
+
+	if n := s.shutdownCounters.undelivered.Load(); n > 0 {
+		return &errors.UndeliveredError{
+			Entries:  int(n),
+			Spooled:  int(s.shutdownCounters.spooled.Load()),
+			Fallback: int(s.shutdownCounters.fallback.Load()),
+			Err:      ctx.Err(),
+		}
+	}
+	return nil
+}
+
+// pendingError reports the entries accepted by Send that have not been delivered yet
+func (s *AsyncSender) pendingError(err error) error {
+	return &errors.UndeliveredError{Entries: int(s.pending.Load()), Err: err}
+}
+
+// aborted reports whether Shutdown gave up waiting for delivery
+func (s *AsyncSender) aborted() bool {
+	return s.sendCtx.Err() != nil
+}
+
+// abandon gives up on a push when the sender is closed. If the entries'
+// spool records are on disk, they are kept and replayed on the next start;
+// otherwise the entries are handed to the fallback sender, or reported as dropped.
+func (s *AsyncSender) abandon(lokiEntry client.LokiEntry, release *batchRelease, err error) {
+	n := entryCount(lokiEntry)
+	s.shutdownCounters.undelivered.Add(int64(n))
+
+	switch {
+	case release.spooled():
+		s.shutdownCounters.spooled.Add(int64(n))
+
+	case s.fallback != nil:
+		for _, e := range pushEntries(lokiEntry) {
+			if s.fallback.Send(context.Background(), e.content, e.labels, e.timestamp) == nil {
+				s.shutdownCounters.fallback.Add(1)
+			}
+		}
+
+	default:
+		s.stats.failed.Add(uint64(n))
+		s.errorHandler(&errors.DroppedError{Entries: n, Reason: "sender closed", Err: err})
+	}
+}
+
+// pushEntries converts a push back into the entries it was built from
+func pushEntries(lokiEntry client.LokiEntry) []entry {
+	var entries []entry
+	for _, stream := range lokiEntry.Streams {
+		labels := stream.Stream
+		if lokiEntry.Tenant != "" {
+			labels = make(map[string]string, len(stream.Stream)+1)
+			for k, v := range stream.Stream {
+				labels[k] = v
+			}
+			labels[client.TenantLabel] = lokiEntry.Tenant
+		}
+
+		for _, value := range stream.Values {
+			ns, _ := strconv.ParseInt(value[0], 10, 64)
+			entries = append(entries, entry{
+				content:   []byte(value[1]),
+				labels:    labels,
+				timestamp: time.Unix(0, ns),
+			})
+		}
+	}
+	return entries
+}
+
+// WithFallback sets a sender that receives the entries Shutdown or Close could
+// not deliver. It is not used together with WithSpool, which keeps such entries
+// on disk instead.
+func WithFallback(sender Sender) AsyncSenderOption {
+	return func(s *AsyncSender) {
+		s.fallback = sender
+	}
+}
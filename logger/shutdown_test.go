@@ -0,0 +1,155 @@
+package logger
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	stderrors "errors"
+
+	"github.com/mwazovzky/cloudlog/client"
+	"github.com/mwazovzky/cloudlog/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// hangingLogSender blocks every push until its context is cancelled
+type hangingLogSender struct{}
+
+func (hangingLogSender) Send(ctx context.Context, _ client.LokiEntry) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func sendEntries(t *testing.T, sender *AsyncSender, n int) {
+	t.Helper()
+	labels := map[string]string{"job": "test"}
+	for i := 0; i < n; i++ {
+		err := sender.Send(ctx, []byte(fmt.Sprintf(`{"i":%d}`, i)), labels, time.Now())
+		require.NoError(t, err)
+	}
+}
+
+func TestAsyncSender_FlushContextDeadline(t *testing.T) {
+	sender := NewAsyncSender(hangingLogSender{}, WithBatchSize(1), WithErrorHandler(func(error) {}))
+	defer sender.Shutdown(canceledContext())
+
+	sendEntries(t, sender, 3)
+
+	flushCtx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	err := sender.FlushContext(flushCtx)
+	var undelivered *errors.UndeliveredError
+	require.True(t, stderrors.As(err, &undelivered))
+	assert.Equal(t, 3, undelivered.Entries)
+	assert.True(t, stderrors.Is(err, context.DeadlineExceeded))
+}
+
+func TestAsyncSender_ShutdownDelivers(t *testing.T) {
+	mock := &asyncMockLogSender{}
+	sender := NewAsyncSender(mock)
+	sendEntries(t, sender, 3)
+
+	assert.NoError(t, sender.Shutdown(context.Background()))
+	assert.Equal(t, 3, mock.totalValues())
+
+	// Later calls are no-ops
+	assert.NoError(t, sender.Shutdown(context.Background()))
+}
+
+func TestAsyncSender_ShutdownDeadlineUsesFallback(t *testing.T) {
+	fallback := &mockSender{}
+	sender := NewAsyncSender(hangingLogSender{},
+		WithBatchSize(1),
+		WithFallback(fallback),
+	)
+	sendEntries(t, sender, 3)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	err := sender.Shutdown(shutdownCtx)
+	var undelivered *errors.UndeliveredError
+	require.True(t, stderrors.As(err, &undelivered))
+	assert.Equal(t, 3, undelivered.Entries)
+	assert.Equal(t, 3, undelivered.Fallback)
+	assert.True(t, stderrors.Is(err, context.DeadlineExceeded))
+
+	assert.ElementsMatch(t, []string{`{"i":0}`, `{"i":1}`, `{"i":2}`}, fallback.contents)
+	for _, labels := range fallback.labels {
+		assert.Equal(t, map[string]string{"job": "test"}, labels)
+	}
+}
+
+func TestAsyncSender_ShutdownDeadlineReportsDropped(t *testing.T) {
+	var dropped []error
+	sender := NewAsyncSender(hangingLogSender{},
+		WithBatchSize(10),
+		WithErrorHandler(func(err error) { dropped = append(dropped, err) }),
+	)
+	sendEntries(t, sender, 2)
+
+	err := sender.Shutdown(canceledContext())
+	var undelivered *errors.UndeliveredError
+	require.True(t, stderrors.As(err, &undelivered))
+	assert.Equal(t, 2, undelivered.Entries)
+	assert.True(t, stderrors.Is(err, context.Canceled))
+
+	require.Len(t, dropped, 1)
+	assert.True(t, stderrors.Is(dropped[0], errors.ErrEntriesDropped))
+}
+
+func TestAsyncSender_ShutdownDeadlineKeepsSpool(t *testing.T) {
+	dir := t.TempDir()
+
+	sender := NewAsyncSender(hangingLogSender{},
+		WithBatchSize(1),
+		WithSpool(SpoolConfig{Dir: dir}),
+	)
+	sendEntries(t, sender, 3)
+
+	err := sender.Shutdown(canceledContext())
+	var undelivered *errors.UndeliveredError
+	require.True(t, stderrors.As(err, &undelivered))
+	assert.Equal(t, 3, undelivered.Spooled)
+
+	mock := &asyncMockLogSender{}
+	sender = NewAsyncSender(mock, WithSpool(SpoolConfig{Dir: dir}))
+	require.NoError(t, sender.Shutdown(context.Background()))
+	assert.Equal(t, 3, mock.totalValues())
+}
+
+func TestAsyncSender_ShutdownCountsOnlySpooledOnDisk(t *testing.T) {
+	dir := t.TempDir()
+
+	var dropped []error
+	sender := NewAsyncSender(hangingLogSender{},
+		WithBatchSize(10),
+		WithSpool(SpoolConfig{Dir: dir, SegmentSize: 1}),
+		WithErrorHandler(func(err error) { dropped = append(dropped, err) }),
+	)
+	sendEntries(t, sender, 2)
+
+	// The segments disappear from disk before the entries are delivered
+	for _, path := range spoolFiles(t, dir) {
+		require.NoError(t, os.Remove(path))
+	}
+
+	err := sender.Shutdown(canceledContext())
+	var undelivered *errors.UndeliveredError
+	require.True(t, stderrors.As(err, &undelivered))
+	assert.Equal(t, 2, undelivered.Entries)
+	assert.Equal(t, 0, undelivered.Spooled)
+
+	require.Len(t, dropped, 1)
+	assert.True(t, stderrors.Is(dropped[0], errors.ErrEntriesDropped))
+}
+
+func canceledContext() context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	return ctx
+}
@@ -0,0 +1,154 @@
+package logger
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/mwazovzky/cloudlog/formatter"
+)
+
+// SlogHandler is a log/slog Handler that formats records like Logger and
+// delivers them through a Sender, so slog.New(handler) ships straight to Loki.
+//
+// Records are mapped onto formatter.LogEntry: the message becomes "message",
+// attributes become key-values and groups become nested objects. slog levels
+// below Info map to "debug", below Warn to "info", below Error to "warn", and
+// the rest to "error". WithLabelKeys promotes top-level attributes to stream labels.
+type SlogHandler struct {
+	l      *logger
+	attrs  []groupedAttrs // attributes from WithAttrs, in call order
+	groups []string       // groups opened by WithGroup
+}
+
+// groupedAttrs are attributes added by WithAttrs inside the given groups
+type groupedAttrs struct {
+	groups []string
+	attrs  []slog.Attr
+}
+
+// NewSlogHandler creates a slog Handler that sends records through sender.
+// It accepts the same options as New.
+func NewSlogHandler(sender Sender, options ...Option) *SlogHandler {
+	return &SlogHandler{l: New(sender, options...).(*logger)}
+}
+
+// Enabled reports whether records at level pass the WithMinLevel filter
+func (h *SlogHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return levelValues[slogLevel(level)] >= h.l.minLevel
+}
+
+// Handle formats the record and passes it to the sender
+func (h *SlogHandler) Handle(ctx context.Context, r slog.Record) error {
+	level := slogLevel(r.Level)
+	if levelValues[level] < h.l.minLevel {
+		return nil
+	}
+
+	keyVals := copyMetadata(h.l.metadata)
+	processKeyvals(keyVals, h.l.contextKeyvals(ctx)...)
+	for _, ga := range h.attrs {
+		addAttrs(groupMap(keyVals, ga.groups), ga.attrs)
+	}
+
+	var attrs []slog.Attr
+	r.Attrs(func(a slog.Attr) bool {
+		attrs = append(attrs, a)
+		return true
+	})
+	if len(attrs) > 0 {
+		addAttrs(groupMap(keyVals, h.groups), attrs)
+	}
+	keyVals["message"] = r.Message
+
+	timestamp := r.Time
+	if timestamp.IsZero() {
+		timestamp = time.Now()
+	}
+
+	return h.l.send(ctx, formatter.LogEntry{
+		Timestamp: timestamp,
+		Job:       h.l.job,
+		Level:     level,
+		KeyVals:   keyVals,
+	})
+}
+
+// WithAttrs returns a handler that adds attrs to every record, inside the current groups
+func (h *SlogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	h2 := *h
+	h2.attrs = append(h.attrs[:len(h.attrs):len(h.attrs)], groupedAttrs{groups: h.groups, attrs: attrs})
+	return &h2
+}
+
+// WithGroup returns a handler that nests subsequent attributes under name
+func (h *SlogHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	h2 := *h
+	h2.groups = append(h.groups[:len(h.groups):len(h.groups)], name)
+	return &h2
+}
+
+// slogLevel maps a slog level onto a cloudlog level name
+func slogLevel(level slog.Level) string {
+	switch {
+	case level < slog.LevelInfo:
+		return "debug"
+	case level < slog.LevelWarn:
+		return "info"
+	case level < slog.LevelError:
+		return "warn"
+	default:
+		return "error"
+	}
+}
+
+// groupMap returns the nested map for the given groups, creating it as needed
+func groupMap(keyVals map[string]interface{}, groups []string) map[string]interface{} {
+	for _, group := range groups {
+		nested, ok := keyVals[group].(map[string]interface{})
+		if !ok {
+			nested = make(map[string]interface{})
+			keyVals[group] = nested
+		}
+		keyVals = nested
+	}
+	return keyVals
+}
+
+// addAttrs stores resolved attributes in keyVals, following the slog.Handler rules:
+// empty attributes and empty groups are ignored, groups without a key are inlined.
+func addAttrs(keyVals map[string]interface{}, attrs []slog.Attr) {
+	for _, a := range attrs {
+		a.Value = a.Value.Resolve()
+		if a.Equal(slog.Attr{}) {
+			continue
+		}
+
+		switch a.Value.Kind() {
+		case slog.KindGroup:
+			group := a.Value.Group()
+			if len(group) == 0 {
+				continue
+			}
+			if a.Key == "" {
+				addAttrs(keyVals, group)
+			} else {
+				addAttrs(groupMap(keyVals, []string{a.Key}), group)
+			}
+		case slog.KindAny:
+			if err, ok := a.Value.Any().(error); ok {
+				keyVals[a.Key] = err.Error()
+			} else {
+				keyVals[a.Key] = a.Value.Any()
+			}
+		default:
+			keyVals[a.Key] = a.Value.Any()
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package logger
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// slogLogger implements Logger on top of any slog.Handler
+type slogLogger struct {
+	handler slog.Handler
+}
+
+// NewSlogLogger returns a Logger that writes to an slog.Handler, e.g. a
+// slog.TextHandler on stdout during development. With adds the key-values as
+// handler attributes and WithJob adds a "job" attribute.
+func NewSlogLogger(handler slog.Handler) Logger {
+	return &slogLogger{handler: handler}
+}
+
+func (l *slogLogger) Info(ctx context.Context, message string, keyvals ...interface{}) error {
+	return l.log(ctx, slog.LevelInfo, message, keyvals...)
+}
+
+func (l *slogLogger) Error(ctx context.Context, message string, keyvals ...interface{}) error {
+	return l.log(ctx, slog.LevelError, message, keyvals...)
+}
+
+func (l *slogLogger) Debug(ctx context.Context, message string, keyvals ...interface{}) error {
+	return l.log(ctx, slog.LevelDebug, message, keyvals...)
+}
+
+func (l *slogLogger) Warn(ctx context.Context, message string, keyvals ...interface{}) error {
+	return l.log(ctx, slog.LevelWarn, message, keyvals...)
+}
+
+func (l *slogLogger) With(keyvals ...interface{}) Logger {
+	return &slogLogger{handler: l.handler.WithAttrs(keyvalsToAttrs(keyvals))}
+}
+
+func (l *slogLogger) WithJob(job string) Logger {
+	return &slogLogger{handler: l.handler.WithAttrs([]slog.Attr{slog.String("job", job)})}
+}
+
+func (l *slogLogger) log(ctx context.Context, level slog.Level, message string, keyvals ...interface{}) error {
+	if !l.handler.Enabled(ctx, level) {
+		return nil
+	}
+	r := slog.NewRecord(time.Now(), level, message, 0)
+	r.Add(keyvals...)
+	return l.handler.Handle(ctx, r)
+}
+
+// keyvalsToAttrs converts alternating key-values to attributes the way slog.Logger does
+func keyvalsToAttrs(keyvals []interface{}) []slog.Attr {
+	r := slog.NewRecord(time.Time{}, 0, "", 0)
+	r.Add(keyvals...)
+
+	attrs := make([]slog.Attr, 0, r.NumAttrs())
+	r.Attrs(func(a slog.Attr) bool {
+		attrs = append(attrs, a)
+		return true
+	})
+	return attrs
+}
+
+// loggerHandler implements slog.Handler on top of a Logger
+type loggerHandler struct {
+	l      Logger
+	attrs  []groupedAttrs // attributes added inside groups
+	groups []string
+}
+
+// NewLoggerHandler returns an slog.Handler that writes to a Logger, for
+// libraries that take a *slog.Logger. Records are logged at the nearest
+// Logger level at or below theirs; attributes added outside any group are
+// passed to Logger.With, so the Logger's metadata, label keys and job apply.
+// The Logger timestamps entries itself, so the record time is not used.
+func NewLoggerHandler(l Logger) slog.Handler {
+	return &loggerHandler{l: l}
+}
+
+// Enabled always reports true; the Logger applies its own level filter
+func (h *loggerHandler) Enabled(context.Context, slog.Level) bool {
+	return true
+}
+
+func (h *loggerHandler) Handle(ctx context.Context, r slog.Record) error {
+	keyVals := make(map[string]interface{})
+	for _, ga := range h.attrs {
+		addAttrs(groupMap(keyVals, ga.groups), ga.attrs)
+	}
+
+	var attrs []slog.Attr
+	r.Attrs(func(a slog.Attr) bool {
+		attrs = append(attrs, a)
+		return true
+	})
+	if len(attrs) > 0 {
+		addAttrs(groupMap(keyVals, h.groups), attrs)
+	}
+
+	keyvals := mapKeyvals(keyVals)
+
+	switch slogLevel(r.Level) {
+	case "debug":
+		return h.l.Debug(ctx, r.Message, keyvals...)
+	case "info":
+		return h.l.Info(ctx, r.Message, keyvals...)
+	case "warn":
+		return h.l.Warn(ctx, r.Message, keyvals...)
+	default:
+		return h.l.Error(ctx, r.Message, keyvals...)
+	}
+}
+
+func (h *loggerHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	h2 := *h
+	if len(h.groups) == 0 {
+		keyVals := make(map[string]interface{})
+		addAttrs(keyVals, attrs)
+		h2.l = h.l.With(mapKeyvals(keyVals)...)
+		return &h2
+	}
+	h2.attrs = append(h.attrs[:len(h.attrs):len(h.attrs)], groupedAttrs{groups: h.groups, attrs: attrs})
+	return &h2
+}
+
+func (h *loggerHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	h2 := *h
+	h2.groups = append(h.groups[:len(h.groups):len(h.groups)], name)
+	return &h2
+}
+
+// mapKeyvals flattens a map into alternating key-values
+func mapKeyvals(keyVals map[string]interface{}) []interface{} {
+	keyvals := make([]interface{}, 0, len(keyVals)*2)
+	for k, v := range keyVals {
+		keyvals = append(keyvals, k, v)
+	}
+	return keyvals
+}
@@ -0,0 +1,82 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type ctxKey struct{}
+
+// contextHandler records the context value seen by Handle
+type contextHandler struct {
+	slog.Handler
+	seen *[]interface{}
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	*h.seen = append(*h.seen, ctx.Value(ctxKey{}))
+	return h.Handler.Handle(ctx, r)
+}
+
+func TestSlogLogger(t *testing.T) {
+	var buf bytes.Buffer
+	log := NewSlogLogger(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelInfo}))
+
+	require.NoError(t, log.With("request_id", "r1").WithJob("api").Warn(ctx, "slow", "ms", 120))
+	require.NoError(t, log.Debug(ctx, "filtered"))
+
+	var record map[string]interface{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &record))
+	assert.Equal(t, "WARN", record["level"])
+	assert.Equal(t, "slow", record["msg"])
+	assert.Equal(t, "r1", record["request_id"])
+	assert.Equal(t, "api", record["job"])
+	assert.Equal(t, float64(120), record["ms"])
+}
+
+func TestSlogLogger_PassesContext(t *testing.T) {
+	var seen []interface{}
+	var buf bytes.Buffer
+	log := NewSlogLogger(contextHandler{Handler: slog.NewTextHandler(&buf, nil), seen: &seen})
+
+	require.NoError(t, log.Info(context.WithValue(ctx, ctxKey{}, "trace-1"), "hello"))
+	assert.Equal(t, []interface{}{"trace-1"}, seen)
+}
+
+func TestLoggerHandler(t *testing.T) {
+	sender := &mockSender{}
+	base := New(sender, WithJob("api"), WithMetadata("env", "prod"), WithLabelKeys("service"))
+	log := slog.New(NewLoggerHandler(base)).With("service", "billing", "request_id", "r1")
+
+	log.WithGroup("http").With("method", "GET").ErrorContext(ctx, "failed", "status", 500)
+	log.Log(ctx, slog.LevelDebug-4, "trace")
+
+	records := decodeContents(t, sender)
+	require.Len(t, records, 2)
+	assert.Equal(t, "error", records[0]["level"])
+	assert.Equal(t, "failed", records[0]["message"])
+	assert.Equal(t, "prod", records[0]["env"])
+	assert.Equal(t, "r1", records[0]["request_id"])
+	assert.Equal(t, map[string]interface{}{"method": "GET", "status": float64(500)}, records[0]["http"])
+	assert.Equal(t, map[string]string{"job": "api", "service": "billing"}, sender.labels[0])
+	assert.Equal(t, "debug", records[1]["level"])
+}
+
+func TestLoggerHandler_RoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	log := NewSlogLogger(NewLoggerHandler(NewSlogLogger(slog.NewJSONHandler(&buf, nil)).With("a", 1)))
+
+	require.NoError(t, log.With("b", 2).Info(ctx, "hello"))
+
+	var record map[string]interface{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &record))
+	assert.Equal(t, "hello", record["msg"])
+	assert.Equal(t, float64(1), record["a"])
+	assert.Equal(t, float64(2), record["b"])
+}
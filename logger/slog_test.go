@@ -0,0 +1,123 @@
+package logger
+
+import (
+	"encoding/json"
+	stderrors "errors"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func decodeContents(t *testing.T, sender *mockSender) []map[string]interface{} {
+	t.Helper()
+	var records []map[string]interface{}
+	for _, content := range sender.contents {
+		var data map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(content), &data))
+		records = append(records, data)
+	}
+	return records
+}
+
+func TestSlogHandler_Record(t *testing.T) {
+	sender := &mockSender{}
+	log := slog.New(NewSlogHandler(sender, WithJob("api"), WithMetadata("env", "prod")))
+
+	log.InfoContext(ctx, "request handled", "status", 200, "err", stderrors.New("boom"), slog.Duration("took", time.Second))
+
+	records := decodeContents(t, sender)
+	require.Len(t, records, 1)
+	assert.Equal(t, "request handled", records[0]["message"])
+	assert.Equal(t, "info", records[0]["level"])
+	assert.Equal(t, "api", records[0]["job"])
+	assert.Equal(t, "prod", records[0]["env"])
+	assert.Equal(t, float64(200), records[0]["status"])
+	assert.Equal(t, "boom", records[0]["err"])
+	assert.Equal(t, float64(time.Second), records[0]["took"])
+	assert.Equal(t, map[string]string{"job": "api"}, sender.labels[0])
+	assert.Equal(t, []int{LevelInfo}, sender.levels)
+}
+
+func TestSlogHandler_Levels(t *testing.T) {
+	sender := &mockSender{}
+	handler := NewSlogHandler(sender, WithMinLevel(LevelWarn))
+	log := slog.New(handler)
+
+	assert.False(t, handler.Enabled(ctx, slog.LevelInfo))
+	assert.True(t, handler.Enabled(ctx, slog.LevelWarn))
+
+	log.Debug("debug")
+	log.Info("info")
+	log.Warn("warn")
+	log.Error("error")
+	log.Log(ctx, slog.LevelError+4, "critical")
+
+	var levels []string
+	for _, record := range decodeContents(t, sender) {
+		levels = append(levels, record["level"].(string))
+	}
+	assert.Equal(t, []string{"warn", "error", "error"}, levels)
+}
+
+func TestSlogHandler_AttrsAndGroups(t *testing.T) {
+	sender := &mockSender{}
+	log := slog.New(NewSlogHandler(sender)).
+		With("a", 1).
+		WithGroup("http").
+		With("method", "GET").
+		WithGroup("response")
+
+	log.Info("done",
+		"status", 200,
+		slog.Group("timing", "ms", 12),
+		slog.Group("", "inline", true),
+		slog.Group("empty"),
+		slog.Attr{},
+	)
+
+	records := decodeContents(t, sender)
+	require.Len(t, records, 1)
+	assert.Equal(t, float64(1), records[0]["a"])
+	assert.Equal(t, map[string]interface{}{
+		"method": "GET",
+		"response": map[string]interface{}{
+			"status": float64(200),
+			"timing": map[string]interface{}{"ms": float64(12)},
+			"inline": true,
+		},
+	}, records[0]["http"])
+}
+
+func TestSlogHandler_EmptyGroupOmitted(t *testing.T) {
+	sender := &mockSender{}
+	slog.New(NewSlogHandler(sender)).WithGroup("g").Info("msg")
+
+	records := decodeContents(t, sender)
+	require.Len(t, records, 1)
+	assert.NotContains(t, records[0], "g")
+}
+
+func TestSlogHandler_LabelKeys(t *testing.T) {
+	sender := &mockSender{}
+	log := slog.New(NewSlogHandler(sender, WithJob("api"), WithLabelKeys("service")))
+
+	log.With("service", "billing").Info("charged", "amount", 10)
+
+	assert.Equal(t, map[string]string{"job": "api", "service": "billing"}, sender.labels[0])
+	records := decodeContents(t, sender)
+	assert.NotContains(t, records[0], "service")
+}
+
+func TestSlogHandler_RecordTime(t *testing.T) {
+	sender := &mockSender{}
+	handler := NewSlogHandler(sender)
+
+	when := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	require.NoError(t, handler.Handle(ctx, slog.NewRecord(when, slog.LevelInfo, "msg", 0)))
+
+	records := decodeContents(t, sender)
+	assert.Equal(t, "2024-01-02T03:04:05Z", records[0]["timestamp"])
+}
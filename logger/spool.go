@@ -0,0 +1,451 @@
+package logger
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mwazovzky/cloudlog/errors"
+)
+
+// SpoolSync controls when spool writes are flushed to stable storage
+type SpoolSync int
+
+const (
+	// SpoolSyncInterval fsyncs at most once per SpoolConfig.SyncInterval (default)
+	SpoolSyncInterval SpoolSync = iota
+	// SpoolSyncAlways fsyncs after every entry
+	SpoolSyncAlways
+	// SpoolSyncNever leaves flushing to the operating system
+	SpoolSyncNever
+)
+
+// SpoolConfig configures the on-disk write-ahead spool of an AsyncSender
+type SpoolConfig struct {
+	// Dir holds the spool segment files; it is created if missing
+	Dir string
+	// MaxBytes caps the total size of all segments; 0 means 256MB
+	MaxBytes int64
+	// SegmentSize is the size at which a new segment file is started; 0 means 8MB
+	SegmentSize int64
+	// Sync selects the fsync policy
+	Sync SpoolSync
+	// SyncInterval is used with SpoolSyncInterval; 0 means 1s
+	SyncInterval time.Duration
+	// ResendInterval is how often records kept after a transient push failure
+	// are sent again while the sender runs; 0 means 10s
+	ResendInterval time.Duration
+}
+
+const (
+	defaultSpoolMaxBytes     = 256 << 20
+	defaultSpoolSegmentSize  = 8 << 20
+	defaultSpoolSyncInterval = time.Second
+	defaultSpoolResend       = 10 * time.Second
+
+	spoolSegmentExt    = ".wal"
+	spoolRecordHeader  = 8 // payload length + CRC-32C
+	spoolMaxRecordSize = 64 << 20
+)
+
+var spoolCRCTable = crc32.MakeTable(crc32.Castagnoli)
+
+// spool persists entries to append-only segment files before they are buffered.
+// Every entry written to a segment is eventually acknowledged, i.e. accepted by
+// Loki or rejected by it with a non-retryable error, or kept after a transient
+// failure. Once a segment is sealed and all its entries are done, it is deleted,
+// or, if it has kept records, queued for them to be sent again.
+type spool struct {
+	cfg SpoolConfig
+
+	mu        sync.Mutex
+	active    *spoolSegment
+	nextSeq   uint64
+	totalSize int64
+	lastSync  time.Time
+	dirty     bool            // the active segment has writes not yet synced
+	pending   []string        // segments left over from a previous run, oldest first
+	resend    []*spoolSegment // segments whose kept records are to be sent again
+}
+
+type spoolSegment struct {
+	path    string
+	file    *os.File
+	size    int64
+	written int
+	done    int
+	kept    []int // indexes of records kept after a transient push failure
+	sealed  bool
+	queued  bool // queued for its kept records to be sent again
+	removed bool
+}
+
+// openSpool prepares the spool directory and collects segments left by a previous run
+func openSpool(cfg SpoolConfig) (*spool, error) {
+	if cfg.MaxBytes <= 0 {
+		cfg.MaxBytes = defaultSpoolMaxBytes
+	}
+	if cfg.SegmentSize <= 0 {
+		cfg.SegmentSize = defaultSpoolSegmentSize
+	}
+	if cfg.SyncInterval <= 0 {
+		cfg.SyncInterval = defaultSpoolSyncInterval
+	}
+	if cfg.ResendInterval <= 0 {
+		cfg.ResendInterval = defaultSpoolResend
+	}
+
+	if err := os.MkdirAll(cfg.Dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	files, err := os.ReadDir(cfg.Dir)
+	if err != nil {
+		return nil, err
+	}
+
+	sp := &spool{cfg: cfg, nextSeq: 1}
+	for _, f := range files {
+		name := f.Name()
+		if f.IsDir() || !strings.HasSuffix(name, spoolSegmentExt) {
+			continue
+		}
+		seq, err := strconv.ParseUint(strings.TrimSuffix(name, spoolSegmentExt), 10, 64)
+		if err != nil {
+			continue
+		}
+		if seq >= sp.nextSeq {
+			sp.nextSeq = seq + 1
+		}
+		if info, err := f.Info(); err == nil {
+			sp.totalSize += info.Size()
+		}
+		sp.pending = append(sp.pending, filepath.Join(cfg.Dir, name))
+	}
+	sort.Strings(sp.pending)
+
+	return sp, nil
+}
+
+// write appends an entry to the active segment and returns the segment it
+// belongs to and the index of its record in the segment
+func (sp *spool) write(e entry) (*spoolSegment, int, error) {
+	record := encodeSpoolRecord(e)
+
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+
+	if sp.totalSize+int64(len(record)) > sp.cfg.MaxBytes {
+		return nil, 0, errors.ErrSpoolFull
+	}
+
+	if sp.active == nil || sp.active.size >= sp.cfg.SegmentSize {
+		if err := sp.rotate(); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	seg := sp.active
+	if _, err := seg.file.Write(record); err != nil {
+		return nil, 0, err
+	}
+
+	switch sp.cfg.Sync {
+	case SpoolSyncAlways:
+		if err := seg.file.Sync(); err != nil {
+			return nil, 0, err
+		}
+	case SpoolSyncInterval:
+		sp.dirty = true
+		if time.Since(sp.lastSync) >= sp.cfg.SyncInterval {
+			if err := sp.sync(); err != nil {
+				return nil, 0, err
+			}
+		}
+	}
+
+	index := seg.written
+	seg.size += int64(len(record))
+	seg.written++
+	sp.totalSize += int64(len(record))
+
+	return seg, index, nil
+}
+
+// sync flushes the active segment to stable storage. Caller holds sp.mu.
+func (sp *spool) sync() error {
+	sp.lastSync = time.Now()
+	if !sp.dirty || sp.active == nil {
+		return nil
+	}
+	sp.dirty = false
+	return sp.active.file.Sync()
+}
+
+// syncIdle syncs writes that have waited for SyncInterval without a later
+// write to sync them, e.g. the tail of a burst
+func (sp *spool) syncIdle() {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+
+	if sp.cfg.Sync == SpoolSyncInterval && time.Since(sp.lastSync) >= sp.cfg.SyncInterval {
+		_ = sp.sync()
+	}
+}
+
+// rotate seals the active segment and starts a new one. Caller holds sp.mu.
+func (sp *spool) rotate() error {
+	if sp.active != nil {
+		sp.seal(sp.active)
+	}
+
+	path := filepath.Join(sp.cfg.Dir, fmt.Sprintf("%020d%s", sp.nextSeq, spoolSegmentExt))
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		sp.active = nil
+		return err
+	}
+	sp.nextSeq++
+
+	sp.active = &spoolSegment{path: path, file: file}
+	sp.dirty = false
+	return nil
+}
+
+// seal closes a segment for writing and settles it if all its entries are done.
+// Caller holds sp.mu.
+func (sp *spool) seal(seg *spoolSegment) {
+	seg.sealed = true
+	if sp.cfg.Sync != SpoolSyncNever {
+		_ = seg.file.Sync()
+	}
+	_ = seg.file.Close()
+	sp.settle(seg)
+}
+
+// settle deletes a sealed segment whose entries are all done, or queues it to
+// be sent again if some of its records were kept. Caller holds sp.mu.
+func (sp *spool) settle(seg *spoolSegment) {
+	if !seg.sealed || seg.removed || seg.queued || seg.done != seg.written {
+		return
+	}
+	if len(seg.kept) > 0 {
+		seg.queued = true
+		sp.resend = append(sp.resend, seg)
+		return
+	}
+	if os.Remove(seg.path) == nil {
+		sp.totalSize -= seg.size
+		seg.removed = true
+	}
+}
+
+// onDisk reports whether all segments are still present in the spool directory
+func (sp *spool) onDisk(segments []*spoolSegment) bool {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+
+	for _, seg := range segments {
+		if seg.removed {
+			return false
+		}
+		if _, err := os.Stat(seg.path); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// ack marks one entry of the segment as done
+func (sp *spool) ack(seg *spoolSegment) {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+
+	seg.done++
+	sp.settle(seg)
+}
+
+// keep marks one entry of the segment as done, keeping its record to be sent again
+func (sp *spool) keep(seg *spoolSegment, record int) {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+
+	seg.kept = append(seg.kept, record)
+	seg.done++
+	sp.settle(seg)
+}
+
+// takeResend returns the segments whose kept records are to be sent again.
+// The active segment is sealed first if it holds kept records, so they are not
+// held back until it fills up.
+func (sp *spool) takeResend() []*spoolSegment {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+
+	if sp.active != nil && len(sp.active.kept) > 0 {
+		sp.seal(sp.active)
+		sp.active = nil
+	}
+
+	resend := sp.resend
+	sp.resend = nil
+	return resend
+}
+
+// takePending returns the segments left over from a previous run
+func (sp *spool) takePending() []string {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+
+	pending := sp.pending
+	sp.pending = nil
+	return pending
+}
+
+// replayed returns a sealed segment for a file whose records are sent again,
+// left over from a previous run or queued by takeResend, holding the given
+// number of entries. Like a live segment, it is settled once every entry is
+// done; one without entries is deleted at once.
+func (sp *spool) replayed(path string, entries int) *spoolSegment {
+	seg := &spoolSegment{path: path, written: entries, sealed: true}
+	if info, err := os.Stat(path); err == nil {
+		seg.size = info.Size()
+	}
+
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+
+	sp.settle(seg)
+	return seg
+}
+
+// close seals the active segment, deleting it if every entry is done
+func (sp *spool) close() {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+
+	if sp.active != nil {
+		sp.seal(sp.active)
+		sp.active = nil
+	}
+}
+
+// encodeSpoolRecord serializes an entry as: length, CRC-32C, payload
+func encodeSpoolRecord(e entry) []byte {
+	payload := make([]byte, spoolRecordHeader, spoolRecordHeader+len(e.content)+64)
+	payload = binary.AppendVarint(payload, e.timestamp.UnixNano())
+	payload = binary.AppendUvarint(payload, uint64(len(e.labels)))
+	for k, v := range e.labels {
+		payload = binary.AppendUvarint(payload, uint64(len(k)))
+		payload = append(payload, k...)
+		payload = binary.AppendUvarint(payload, uint64(len(v)))
+		payload = append(payload, v...)
+	}
+	payload = binary.AppendUvarint(payload, uint64(len(e.content)))
+	payload = append(payload, e.content...)
+
+	body := payload[spoolRecordHeader:]
+	binary.LittleEndian.PutUint32(payload[0:4], uint32(len(body)))
+	binary.LittleEndian.PutUint32(payload[4:8], crc32.Checksum(body, spoolCRCTable))
+	return payload
+}
+
+// readSpoolSegment decodes all intact records of a segment file. A torn or
+// corrupted record ends the segment; the entries before it are returned
+// together with an error describing the damage.
+func readSpoolSegment(path string) ([]entry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = file.Close() }()
+
+	reader := bufio.NewReader(file)
+	header := make([]byte, spoolRecordHeader)
+
+	var entries []entry
+	for {
+		if _, err := io.ReadFull(reader, header); err != nil {
+			if err == io.EOF {
+				return entries, nil
+			}
+			return entries, fmt.Errorf("spool segment %s: truncated record header", path)
+		}
+
+		size := binary.LittleEndian.Uint32(header[0:4])
+		if size > spoolMaxRecordSize {
+			return entries, fmt.Errorf("spool segment %s: invalid record size %d", path, size)
+		}
+
+		body := make([]byte, size)
+		if _, err := io.ReadFull(reader, body); err != nil {
+			return entries, fmt.Errorf("spool segment %s: truncated record", path)
+		}
+		if crc32.Checksum(body, spoolCRCTable) != binary.LittleEndian.Uint32(header[4:8]) {
+			return entries, fmt.Errorf("spool segment %s: checksum mismatch", path)
+		}
+
+		e, err := decodeSpoolRecord(body)
+		if err != nil {
+			return entries, fmt.Errorf("spool segment %s: %v", path, err)
+		}
+		entries = append(entries, e)
+	}
+}
+
+func decodeSpoolRecord(b []byte) (entry, error) {
+	var e entry
+
+	ns, n := binary.Varint(b)
+	if n <= 0 {
+		return e, fmt.Errorf("invalid timestamp")
+	}
+	b = b[n:]
+	e.timestamp = time.Unix(0, ns)
+
+	readBytes := func() ([]byte, bool) {
+		size, n := binary.Uvarint(b)
+		if n <= 0 || uint64(len(b)-n) < size {
+			return nil, false
+		}
+		value := b[n : n+int(size)]
+		b = b[n+int(size):]
+		return value, true
+	}
+
+	count, n := binary.Uvarint(b)
+	if n <= 0 {
+		return e, fmt.Errorf("invalid label count")
+	}
+	b = b[n:]
+
+	e.labels = make(map[string]string, count)
+	for i := uint64(0); i < count; i++ {
+		k, ok := readBytes()
+		if !ok {
+			return e, fmt.Errorf("invalid label key")
+		}
+		v, ok := readBytes()
+		if !ok {
+			return e, fmt.Errorf("invalid label value")
+		}
+		e.labels[string(k)] = string(v)
+	}
+
+	content, ok := readBytes()
+	if !ok {
+		return e, fmt.Errorf("invalid content")
+	}
+	e.content = append([]byte(nil), content...)
+
+	return e, nil
+}
@@ -0,0 +1,342 @@
+package logger
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	stderrors "errors"
+
+	"github.com/mwazovzky/cloudlog/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func spoolFiles(t *testing.T, dir string) []string {
+	matches, err := filepath.Glob(filepath.Join(dir, "*"+spoolSegmentExt))
+	require.NoError(t, err)
+	return matches
+}
+
+func testEntry(i int) entry {
+	return entry{
+		content:   []byte(fmt.Sprintf(`{"i":%d}`, i)),
+		labels:    map[string]string{"job": "test", "n": fmt.Sprint(i % 2)},
+		timestamp: time.Unix(0, int64(1700000000000000000+i)),
+	}
+}
+
+func TestSpool_RecordRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	sp, err := openSpool(SpoolConfig{Dir: dir, Sync: SpoolSyncAlways})
+	require.NoError(t, err)
+
+	for i := 0; i < 5; i++ {
+		_, _, err := sp.write(testEntry(i))
+		require.NoError(t, err)
+	}
+
+	files := spoolFiles(t, dir)
+	require.Len(t, files, 1)
+
+	entries, err := readSpoolSegment(files[0])
+	require.NoError(t, err)
+	require.Len(t, entries, 5)
+	for i, e := range entries {
+		want := testEntry(i)
+		assert.Equal(t, want.content, e.content)
+		assert.Equal(t, want.labels, e.labels)
+		assert.True(t, want.timestamp.Equal(e.timestamp))
+	}
+}
+
+func TestSpool_TornAndCorruptRecords(t *testing.T) {
+	dir := t.TempDir()
+	sp, err := openSpool(SpoolConfig{Dir: dir})
+	require.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		_, _, err := sp.write(testEntry(i))
+		require.NoError(t, err)
+	}
+	sp.close()
+
+	path := spoolFiles(t, dir)[0]
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	// Torn write: the last record is cut short
+	require.NoError(t, os.WriteFile(path, data[:len(data)-3], 0o644))
+	entries, err := readSpoolSegment(path)
+	assert.Error(t, err)
+	assert.Len(t, entries, 2)
+
+	// Bit flip in the second record's payload
+	corrupt := append([]byte(nil), data...)
+	recordLen := len(encodeSpoolRecord(testEntry(0)))
+	corrupt[recordLen+spoolRecordHeader+2] ^= 0xff
+	require.NoError(t, os.WriteFile(path, corrupt, 0o644))
+	entries, err = readSpoolSegment(path)
+	assert.ErrorContains(t, err, "checksum")
+	assert.Len(t, entries, 1)
+}
+
+func TestSpool_SegmentsRemovedWhenAcked(t *testing.T) {
+	dir := t.TempDir()
+	recordLen := int64(len(encodeSpoolRecord(testEntry(0))))
+	sp, err := openSpool(SpoolConfig{Dir: dir, SegmentSize: 2 * recordLen})
+	require.NoError(t, err)
+
+	var segments []*spoolSegment
+	for i := 0; i < 5; i++ {
+		seg, _, err := sp.write(testEntry(i))
+		require.NoError(t, err)
+		segments = append(segments, seg)
+	}
+	assert.Len(t, spoolFiles(t, dir), 3)
+
+	sp.ack(segments[0])
+	assert.Len(t, spoolFiles(t, dir), 3, "segment with unacked entries is kept")
+	sp.ack(segments[1])
+	assert.Len(t, spoolFiles(t, dir), 2)
+
+	sp.ack(segments[4])
+	assert.Len(t, spoolFiles(t, dir), 2, "active segment is kept until sealed")
+
+	sp.ack(segments[2])
+	sp.ack(segments[3])
+	sp.close()
+	assert.Empty(t, spoolFiles(t, dir))
+	assert.Equal(t, int64(0), sp.totalSize)
+}
+
+func TestSpool_SizeCap(t *testing.T) {
+	recordLen := int64(len(encodeSpoolRecord(testEntry(0))))
+	sp, err := openSpool(SpoolConfig{Dir: t.TempDir(), MaxBytes: 2 * recordLen})
+	require.NoError(t, err)
+
+	seg, _, err := sp.write(testEntry(0))
+	require.NoError(t, err)
+	_, _, err = sp.write(testEntry(1))
+	require.NoError(t, err)
+
+	_, _, err = sp.write(testEntry(2))
+	assert.True(t, stderrors.Is(err, errors.ErrSpoolFull))
+
+	// Acknowledged space in the active segment is only reclaimed once the segment is removed
+	sp.ack(seg)
+	_, _, err = sp.write(testEntry(2))
+	assert.True(t, stderrors.Is(err, errors.ErrSpoolFull))
+}
+
+func TestAsyncSender_SpoolReplayedOnRestart(t *testing.T) {
+	dir := t.TempDir()
+
+	// Simulate a crash: entries reached the spool but were never acknowledged
+	sp, err := openSpool(SpoolConfig{Dir: dir})
+	require.NoError(t, err)
+	for i := 0; i < 7; i++ {
+		_, _, err := sp.write(testEntry(i))
+		require.NoError(t, err)
+	}
+	sp.close()
+	require.Len(t, spoolFiles(t, dir), 1)
+
+	mock := &asyncMockLogSender{}
+	sender := NewAsyncSender(mock, WithBatchSize(3), WithSpool(SpoolConfig{Dir: dir}))
+
+	err = sender.Send(ctx, []byte(`{"msg":"new"}`), map[string]string{"job": "test"}, time.Now())
+	assert.NoError(t, err)
+	sender.Close()
+
+	assert.Equal(t, 8, mock.totalValues())
+	assert.Empty(t, spoolFiles(t, dir))
+}
+
+func TestAsyncSender_SpoolKeepsUndeliveredEntries(t *testing.T) {
+	dir := t.TempDir()
+
+	blockCh := make(chan struct{})
+	mock := &asyncMockLogSender{}
+	sender := NewAsyncSender(&blockingLogSender{ch: blockCh, delegate: mock},
+		WithBatchSize(1),
+		WithSpool(SpoolConfig{Dir: dir, Sync: SpoolSyncAlways}),
+	)
+
+	labels := map[string]string{"job": "test"}
+	for i := 0; i < 3; i++ {
+		err := sender.Send(ctx, []byte(fmt.Sprintf(`{"i":%d}`, i)), labels, time.Now())
+		assert.NoError(t, err)
+	}
+
+	// Before Loki accepts anything, every entry is on disk
+	files := spoolFiles(t, dir)
+	require.Len(t, files, 1)
+	entries, err := readSpoolSegment(files[0])
+	require.NoError(t, err)
+	assert.Len(t, entries, 3)
+
+	close(blockCh)
+	sender.Close()
+
+	assert.Equal(t, 3, mock.totalValues())
+	assert.Empty(t, spoolFiles(t, dir))
+}
+
+func TestAsyncSender_SpoolKeepsAbandonedRetries(t *testing.T) {
+	dir := t.TempDir()
+
+	failing := &flakyLogSender{}
+	failing.failures.Store(100)
+	sender := NewAsyncSender(failing,
+		WithRetryQueue(RetryQueueConfig{}),
+		WithSpool(SpoolConfig{Dir: dir}),
+		WithErrorHandler(func(error) {}),
+	)
+	require.NoError(t, sender.Send(ctx, []byte(`{"msg":"pending"}`), map[string]string{"job": "test"}, time.Now()))
+	sender.Close()
+
+	// Pushes still waiting for a retry at shutdown stay in the spool
+	require.Len(t, spoolFiles(t, dir), 1)
+
+	mock := &asyncMockLogSender{}
+	sender = NewAsyncSender(mock, WithSpool(SpoolConfig{Dir: dir}))
+	sender.Close()
+
+	assert.Equal(t, 1, mock.totalValues())
+	assert.Empty(t, spoolFiles(t, dir))
+}
+
+func TestAsyncSender_SpoolKeepsEntriesAfterTransientFailure(t *testing.T) {
+	dir := t.TempDir()
+	labels := map[string]string{"job": "test"}
+
+	// Loki is down and there is no retry queue: the failure is reported,
+	// but the entries stay on disk
+	down := &asyncMockLogSender{err: &errors.SendError{Err: errors.ErrConnectionFailed, Retryable: true}}
+	var errs []error
+	sender := NewAsyncSender(down,
+		WithSpool(SpoolConfig{Dir: dir}),
+		WithErrorHandler(func(err error) { errs = append(errs, err) }),
+	)
+	require.NoError(t, sender.Send(ctx, []byte(`{"i":1}`), labels, time.Now()))
+	require.NoError(t, sender.Send(ctx, []byte(`{"i":2}`), labels, time.Now()))
+	sender.Close()
+
+	require.Len(t, errs, 1)
+	require.Len(t, spoolFiles(t, dir), 1)
+
+	// They are delivered once Loki is back
+	mock := &asyncMockLogSender{}
+	sender = NewAsyncSender(mock, WithSpool(SpoolConfig{Dir: dir}))
+	sender.Close()
+
+	assert.Equal(t, 2, mock.totalValues())
+	assert.Empty(t, spoolFiles(t, dir))
+}
+
+func TestAsyncSender_SpoolDiscardsRejectedEntries(t *testing.T) {
+	dir := t.TempDir()
+
+	rejecting := &asyncMockLogSender{err: &errors.SendError{Err: errors.ErrInvalidInput, StatusCode: 400}}
+	sender := NewAsyncSender(rejecting,
+		WithSpool(SpoolConfig{Dir: dir}),
+		WithErrorHandler(func(error) {}),
+	)
+	require.NoError(t, sender.Send(ctx, []byte(`{"i":1}`), map[string]string{"job": "test"}, time.Now()))
+	sender.Close()
+
+	// Loki will never accept the entries, so they are not kept for replay
+	assert.Empty(t, spoolFiles(t, dir))
+}
+
+func TestAsyncSender_SpoolKeepsReplayedSegmentUntilDelivered(t *testing.T) {
+	dir := t.TempDir()
+
+	sp, err := openSpool(SpoolConfig{Dir: dir})
+	require.NoError(t, err)
+	for i := 0; i < 5; i++ {
+		_, _, err := sp.write(testEntry(i))
+		require.NoError(t, err)
+	}
+	sp.close()
+
+	// Loki is still down after the restart: the replayed pushes wait in the
+	// retry queue, and their segment must stay on disk meanwhile
+	down := &flakyLogSender{}
+	down.failures.Store(1000)
+	sender := NewAsyncSender(down,
+		WithRetryQueue(RetryQueueConfig{BaseDelay: time.Hour}),
+		WithSpool(SpoolConfig{Dir: dir}),
+		WithErrorHandler(func(error) {}),
+	)
+	sender.Flush()
+	assert.Len(t, spoolFiles(t, dir), 1)
+
+	err = sender.Shutdown(canceledContext())
+	var undelivered *errors.UndeliveredError
+	require.True(t, stderrors.As(err, &undelivered))
+	assert.Equal(t, 5, undelivered.Spooled)
+	require.Len(t, spoolFiles(t, dir), 1)
+
+	mock := &asyncMockLogSender{}
+	sender = NewAsyncSender(mock, WithSpool(SpoolConfig{Dir: dir}))
+	sender.Close()
+
+	assert.Equal(t, 5, mock.totalValues())
+	assert.Empty(t, spoolFiles(t, dir))
+}
+
+func TestAsyncSender_SpoolResendsKeptRecordsAfterRecovery(t *testing.T) {
+	dir := t.TempDir()
+	labels := map[string]string{"job": "test"}
+	recordLen := int64(len(encodeSpoolRecord(entry{content: []byte(`{"i":10}`), labels: labels, timestamp: time.Now()})))
+
+	mock := &asyncMockLogSender{}
+	setDown := func(down bool) {
+		mock.mu.Lock()
+		defer mock.mu.Unlock()
+		mock.err = nil
+		if down {
+			mock.err = &errors.SendError{Err: errors.ErrConnectionFailed, Retryable: true}
+		}
+	}
+
+	sender := NewAsyncSender(mock,
+		WithSpool(SpoolConfig{Dir: dir, SegmentSize: recordLen, MaxBytes: 3 * recordLen, ResendInterval: 10 * time.Millisecond}),
+		WithErrorHandler(func(error) {}),
+	)
+	defer sender.Close()
+
+	// Many short outages, each keeping one record; once Loki recovers, the
+	// record is sent again and its segment released, so the cap is never reached
+	for i := 0; i < 10; i++ {
+		setDown(true)
+		require.NoError(t, sender.Send(ctx, []byte(fmt.Sprintf(`{"i":%d}`, i)), labels, time.Now()), "outage %d", i)
+		sender.Flush()
+
+		setDown(false)
+		require.Eventually(t, func() bool { return mock.totalValues() == i+1 }, time.Second, time.Millisecond, "outage %d", i)
+		require.Eventually(t, func() bool { return len(spoolFiles(t, dir)) == 0 }, time.Second, time.Millisecond)
+	}
+
+	assert.NoError(t, sender.Send(ctx, []byte(`{"i":10}`), labels, time.Now()))
+}
+
+func TestSpool_SyncsIdleWrites(t *testing.T) {
+	sp, err := openSpool(SpoolConfig{Dir: t.TempDir(), SyncInterval: 10 * time.Millisecond})
+	require.NoError(t, err)
+	defer sp.close()
+
+	// The first write syncs; the second is left for the interval
+	for i := 0; i < 2; i++ {
+		_, _, err := sp.write(testEntry(i))
+		require.NoError(t, err)
+	}
+	assert.True(t, sp.dirty)
+
+	time.Sleep(20 * time.Millisecond)
+	sp.syncIdle()
+	assert.False(t, sp.dirty)
+}
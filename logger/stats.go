@@ -0,0 +1,93 @@
+package logger
+
+import (
+	"expvar"
+	"sync/atomic"
+
+	"github.com/mwazovzky/cloudlog/metrics"
+)
+
+// Stats is a snapshot of AsyncSender activity since it was created
+type Stats struct {
+	// Enqueued is the number of entries accepted by Send, plus entries replayed from the spool
+	Enqueued uint64
+	// Sent is the number of entries accepted by Loki
+	Sent uint64
+	// Dropped is the number of entries refused with ErrBufferFull
+	Dropped uint64
+	// Failed is the number of entries whose push failed and was reported to the
+	// error handler, or discarded by the retry queue
+	Failed uint64
+	// Retried is the number of entries sent again after a failed or rate-limited push
+	Retried uint64
+	// QueueDepth is the number of entries currently waiting in the buffers
+	QueueDepth int
+	// Pushes is the number of push requests that reached Loki successfully
+	Pushes uint64
+	// BytesSent is the estimated encoded size of the entries accepted by Loki,
+	// before compression
+	BytesSent uint64
+	// BatchLatency is the distribution of push durations, successful or not
+	BatchLatency LatencyHistogram
+	// Overflow counts the outcomes of overflow handling
+	Overflow OverflowStats
+}
+
+// LatencyHistogram is a cumulative histogram of push durations
+type LatencyHistogram = metrics.HistogramSnapshot
+
+// LatencyBucket is one bucket of a LatencyHistogram
+type LatencyBucket = metrics.Bucket
+
+// statsCounters holds the live counters behind Stats
+type statsCounters struct {
+	enqueued  atomic.Uint64
+	sent      atomic.Uint64
+	failed    atomic.Uint64
+	retried   atomic.Uint64
+	pushes    atomic.Uint64
+	bytesSent atomic.Uint64
+	latency   metrics.Histogram
+}
+
+// Stats returns a snapshot of the sender's counters. It is safe to call
+// concurrently with Send; counters are read individually, so a snapshot taken
+// while entries are in flight may be slightly inconsistent.
+func (s *AsyncSender) Stats() Stats {
+	depth, _ := s.bufferFill()
+
+	return Stats{
+		Enqueued:     s.stats.enqueued.Load(),
+		Sent:         s.stats.sent.Load(),
+		Dropped:      s.overflowCounters.rejected.Load(),
+		Failed:       s.stats.failed.Load(),
+		Retried:      s.stats.retried.Load(),
+		QueueDepth:   depth,
+		Pushes:       s.stats.pushes.Load(),
+		BytesSent:    s.stats.bytesSent.Load(),
+		BatchLatency: s.stats.latency.Snapshot(),
+		Overflow:     s.OverflowStats(),
+	}
+}
+
+// bufferFill returns the entries waiting in the worker buffers and priority lanes, and their capacity
+func (s *AsyncSender) bufferFill() (depth, capacity int) {
+	for _, w := range s.workers {
+		depth += len(w.buffer) + len(w.priority)
+		capacity += cap(w.buffer) + cap(w.priority)
+	}
+	return depth, capacity
+}
+
+// PublishExpvar exports the sender's Stats as the expvar variable name, so they
+// appear under /debug/vars. Like expvar.Publish, it panics if name is already in use.
+func (s *AsyncSender) PublishExpvar(name string) {
+	expvar.Publish(name, expvar.Func(func() any { return s.Stats() }))
+}
+
+// WithSenderMetrics reports the fill of the sender's buffers in the registry
+func WithSenderMetrics(registry *metrics.Registry) AsyncSenderOption {
+	return func(s *AsyncSender) {
+		s.metrics = registry
+	}
+}
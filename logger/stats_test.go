@@ -0,0 +1,129 @@
+package logger
+
+import (
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mwazovzky/cloudlog/metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAsyncSender_Stats(t *testing.T) {
+	mock := &asyncMockLogSender{}
+	sender := NewAsyncSender(mock, WithBatchSize(2))
+	sendEntries(t, sender, 5)
+	sender.Flush()
+
+	stats := sender.Stats()
+	assert.Equal(t, uint64(5), stats.Enqueued)
+	assert.Equal(t, uint64(5), stats.Sent)
+	assert.Equal(t, uint64(3), stats.Pushes)
+	assert.Zero(t, stats.QueueDepth)
+	assert.Zero(t, stats.Failed)
+
+	var bytes uint64
+	for _, e := range mock.getEntries() {
+		bytes += uint64(entrySize(e))
+	}
+	assert.Equal(t, bytes, stats.BytesSent)
+
+	latency := stats.BatchLatency
+	assert.Equal(t, uint64(3), latency.Count)
+	require.Len(t, latency.Buckets, len(metrics.LatencyBounds))
+	assert.Equal(t, uint64(3), latency.Buckets[len(latency.Buckets)-1].Count)
+	sender.Close()
+}
+
+func TestAsyncSender_StatsDroppedAndQueueDepth(t *testing.T) {
+	mock := &asyncMockLogSender{}
+	sender, release := stalledSender(t, mock, WithBufferSize(2))
+
+	labels := map[string]string{"job": "test"}
+	for _, content := range []string{"a", "b", "c"} {
+		_ = sender.Send(ctx, []byte(content), labels, time.Now())
+	}
+
+	stats := sender.Stats()
+	assert.Equal(t, uint64(3), stats.Enqueued)
+	assert.Equal(t, uint64(1), stats.Dropped)
+	assert.Equal(t, 2, stats.QueueDepth)
+
+	release()
+	sender.Close()
+}
+
+func TestAsyncSender_StatsFailedAndRetried(t *testing.T) {
+	failing := &flakyLogSender{}
+	failing.failures.Store(1)
+	sender := NewAsyncSender(failing,
+		WithRetryQueue(RetryQueueConfig{BaseDelay: time.Millisecond}),
+		WithErrorHandler(func(error) {}),
+	)
+	sendEntries(t, sender, 2)
+	sender.Close()
+
+	stats := sender.Stats()
+	assert.Equal(t, uint64(2), stats.Retried)
+	assert.Equal(t, uint64(2), stats.Sent)
+	assert.Equal(t, uint64(2), stats.BatchLatency.Count)
+
+	sender = NewAsyncSender(&asyncMockLogSender{err: fmt.Errorf("boom")}, WithErrorHandler(func(error) {}))
+	sendEntries(t, sender, 2)
+	sender.Close()
+	assert.Equal(t, uint64(2), sender.Stats().Failed)
+}
+
+func TestAsyncSender_StatsConcurrentReads(t *testing.T) {
+	sender := NewAsyncSender(&asyncMockLogSender{}, WithBatchSize(10), WithFlushInterval(time.Millisecond))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				_ = sender.Send(ctx, []byte(fmt.Sprintf(`{"j":%d}`, j)), map[string]string{"job": "test"}, time.Now())
+				_ = sender.Stats()
+			}
+		}()
+	}
+	wg.Wait()
+	sender.Close()
+
+	assert.Equal(t, uint64(400), sender.Stats().Sent)
+}
+
+func TestAsyncSender_PublishExpvar(t *testing.T) {
+	sender := NewAsyncSender(&asyncMockLogSender{})
+	sendEntries(t, sender, 1)
+	sender.Close()
+
+	name := fmt.Sprintf("cloudlog_test_%d", time.Now().UnixNano())
+	sender.PublishExpvar(name)
+
+	var stats Stats
+	require.NoError(t, json.Unmarshal([]byte(expvar.Get(name).String()), &stats))
+	assert.Equal(t, uint64(1), stats.Sent)
+}
+
+func TestAsyncSender_SenderMetrics(t *testing.T) {
+	registry := metrics.NewRegistry()
+	mock := &asyncMockLogSender{}
+	sender, release := stalledSender(t, mock, WithBufferSize(10), WithSenderMetrics(registry))
+
+	sendEntries(t, sender, 3)
+
+	var out strings.Builder
+	require.NoError(t, registry.Write(&out))
+	assert.Contains(t, out.String(), "cloudlog_buffer_entries 3\n")
+	assert.Contains(t, out.String(), "cloudlog_buffer_capacity 10\n")
+
+	release()
+	sender.Close()
+}
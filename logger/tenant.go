@@ -0,0 +1,38 @@
+package logger
+
+import (
+	"context"
+
+	"github.com/mwazovzky/cloudlog/client"
+)
+
+type tenantContextKey struct{}
+
+// ContextWithTenant returns a context that routes entries logged with it to the given Loki tenant.
+// It takes precedence over the logger's WithTenant option.
+func ContextWithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantContextKey{}, tenant)
+}
+
+// TenantFromContext returns the tenant stored by ContextWithTenant, if any
+func TenantFromContext(ctx context.Context) (string, bool) {
+	tenant, ok := ctx.Value(tenantContextKey{}).(string)
+	return tenant, ok && tenant != ""
+}
+
+// splitTenant returns the labels without the reserved tenant label, and the tenant it carried.
+// The input map is not modified.
+func splitTenant(labels map[string]string) (map[string]string, string) {
+	tenant, ok := labels[client.TenantLabel]
+	if !ok {
+		return labels, ""
+	}
+
+	stream := make(map[string]string, len(labels)-1)
+	for k, v := range labels {
+		if k != client.TenantLabel {
+			stream[k] = v
+		}
+	}
+	return stream, tenant
+}
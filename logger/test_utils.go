@@ -12,10 +12,11 @@ type mockSender struct {
 	mu         sync.Mutex
 	contents   []string
 	labels     []map[string]string
+	levels     []int
 	shouldFail bool
 }
 
-func (m *mockSender) Send(_ context.Context, content []byte, labels map[string]string, _ time.Time) error {
+func (m *mockSender) Send(ctx context.Context, content []byte, labels map[string]string, _ time.Time) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
@@ -25,5 +26,8 @@ func (m *mockSender) Send(_ context.Context, content []byte, labels map[string]s
 
 	m.contents = append(m.contents, string(content))
 	m.labels = append(m.labels, labels)
+	if level, ok := LevelFromContext(ctx); ok {
+		m.levels = append(m.levels, level)
+	}
 	return nil
 }
@@ -0,0 +1,289 @@
+package logger
+
+import (
+	"fmt"
+	"hash/fnv"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/mwazovzky/cloudlog/client"
+)
+
+// worker owns one shard of the AsyncSender: its buffer, priority lane and
+// retry queue, and the goroutine that batches and sends them. Every stream is
+// assigned to exactly one worker, so its entries are sent in order.
+type worker struct {
+	s          *AsyncSender
+	buffer     chan entry
+	priority   chan entry   // warn/error lane, nil unless WithPriorityLane
+	resend     chan []entry // spool records sent again, nil unless WithSpool
+	retryQueue *retryQueue
+	batching   *batchController // nil unless WithAdaptiveBatching
+	admit      sync.RWMutex     // held exclusively while dropLowLevel refills the buffer
+}
+
+func newWorker(s *AsyncSender, capacity int) *worker {
+	w := &worker{s: s}
+
+	reserved := 0
+	if s.priorityShare > 0 {
+		reserved = min(max(int(float64(capacity)*s.priorityShare), 1), capacity-1)
+	}
+	if reserved > 0 {
+		w.priority = make(chan entry, reserved)
+	}
+	w.buffer = make(chan entry, capacity-reserved)
+
+	if s.spool != nil {
+		w.resend = make(chan []entry)
+	}
+	if s.retryConfig != nil {
+		w.retryQueue = newRetryQueue(*s.retryConfig)
+	}
+	if s.adaptive != nil {
+		w.batching = newBatchController(*s.adaptive, s.batchSize)
+	}
+
+	return w
+}
+
+// workerFor returns the worker responsible for the stream with the given labels
+func (s *AsyncSender) workerFor(labels map[string]string) *worker {
+	if len(s.workers) == 1 {
+		return s.workers[0]
+	}
+
+	h := fnv.New32a()
+	h.Write([]byte(labelKey(labels)))
+	return s.workers[h.Sum32()%uint32(len(s.workers))]
+}
+
+// run is the background goroutine that pulls entries, batches them, and sends.
+func (w *worker) run() {
+	defer w.s.wg.Done()
+
+	batch := &pendingBatch{entries: make([]entry, 0, w.batchSize())}
+	ticker := time.NewTicker(w.flushInterval())
+	defer ticker.Stop()
+
+	for {
+		// Priority entries are taken ahead of anything waiting in the buffer
+		select {
+		case e := <-w.priority:
+			w.addPriority(batch, e)
+			continue
+		default:
+		}
+
+		select {
+		case e := <-w.priority:
+			w.addPriority(batch, e)
+
+		case e := <-w.buffer:
+			if e.flushCh != nil {
+				w.flushPending(batch)
+				w.retryNow()
+				close(e.flushCh)
+				continue
+			}
+
+			batch.add(e)
+			if w.batchFull(batch) {
+				w.flushPending(batch)
+				w.adapt(ticker, 0, true)
+			}
+
+		case <-ticker.C:
+			n := len(batch.entries)
+			w.flushPending(batch)
+			w.adapt(ticker, n, false)
+
+		case <-w.retryQueue.ready():
+			w.retry(false)
+
+		case entries := <-w.resend:
+			w.sendAll(entries)
+
+		case <-w.s.done:
+			w.drain(batch)
+			return
+		}
+	}
+}
+
+// pendingBatch accumulates entries in the worker until they are sent
+type pendingBatch struct {
+	entries []entry
+	bytes   int64
+}
+
+func (b *pendingBatch) add(e entry) {
+	b.entries = append(b.entries, e)
+	b.bytes += e.size
+}
+
+// batchFull reports whether the batch reached the entry count or byte limit
+func (w *worker) batchFull(b *pendingBatch) bool {
+	return len(b.entries) >= w.batchSize() || (w.s.maxBatchBytes > 0 && b.bytes >= int64(w.s.maxBatchBytes))
+}
+
+// flushPending sends the pending batch, if any, and resets it
+func (w *worker) flushPending(b *pendingBatch) {
+	if len(b.entries) > 0 {
+		w.sendBatch(b.entries)
+	}
+	b.entries = b.entries[:0]
+	b.bytes = 0
+}
+
+// addPriority adds a priority entry to the batch, after the entries of its
+// stream already waiting in the buffer, so it never overtakes them. Buffered
+// entries of other streams are added after it. The priority entry is sent as
+// soon as no further priority entries are waiting, without waiting for the
+// flush interval.
+func (w *worker) addPriority(b *pendingBatch, e entry) {
+	later, flushChs := w.takeBuffered(b, labelKey(e.labels))
+	b.add(e)
+	if len(later) > 0 || len(flushChs) > 0 || w.batchFull(b) || len(w.priority) == 0 {
+		w.flushPending(b)
+	}
+
+	for _, other := range later {
+		b.add(other)
+		if w.batchFull(b) {
+			w.flushPending(b)
+		}
+	}
+
+	if len(flushChs) > 0 {
+		w.flushPending(b)
+		w.retryNow()
+		for _, flushCh := range flushChs {
+			close(flushCh)
+		}
+	}
+}
+
+// takeBuffered empties the buffer. Entries of the given stream are moved into
+// the batch, which is sent whenever it is full; entries of other streams are
+// returned in order, to be added after the priority entry. Flush markers are
+// returned too, to be closed by the caller once everything has been sent.
+func (w *worker) takeBuffered(b *pendingBatch, stream string) (later []entry, flushChs []chan struct{}) {
+	for n := len(w.buffer); n > 0; n-- {
+		select {
+		case e := <-w.buffer:
+			switch {
+			case e.flushCh != nil:
+				flushChs = append(flushChs, e.flushCh)
+			case labelKey(e.labels) != stream:
+				later = append(later, e)
+			default:
+				b.add(e)
+				if w.batchFull(b) {
+					w.flushPending(b)
+				}
+			}
+		default:
+			// OverflowDropOldest took the entry
+			return later, flushChs
+		}
+	}
+	return later, flushChs
+}
+
+// drain sends everything left in the priority lane and the buffer when the sender is closed
+func (w *worker) drain(b *pendingBatch) {
+	for {
+		select {
+		case e := <-w.priority:
+			b.add(e)
+			continue
+		default:
+		}
+
+		select {
+		case e := <-w.buffer:
+			if e.flushCh != nil {
+				w.flushPending(b)
+				w.retryNow()
+				close(e.flushCh)
+				continue
+			}
+			b.add(e)
+		default:
+			w.flushPending(b)
+			if w.retryQueue != nil {
+				w.retry(true)
+				w.abandonRetries()
+			}
+			return
+		}
+	}
+}
+
+// sendAll sends entries in batches of the configured size
+func (w *worker) sendAll(entries []entry) {
+	for len(entries) > 0 {
+		n := min(len(entries), w.batchSize())
+		w.sendBatch(entries[:n])
+		entries = entries[n:]
+	}
+}
+
+// sendBatch groups entries by their full label set and sends one LokiEntry per tenant,
+// so a single push request never mixes tenants.
+func (w *worker) sendBatch(batch []entry) {
+	if len(batch) == 0 {
+		return
+	}
+
+	if w.priority != nil {
+		// Entries taken from the buffer along with a priority entry may be newer than it
+		slices.SortStableFunc(batch, func(a, b entry) int { return a.timestamp.Compare(b.timestamp) })
+	}
+
+	type streamGroup struct {
+		labels map[string]string
+		tenant string
+		values [][]string
+	}
+
+	groups := make(map[string]*streamGroup)
+	for _, e := range batch {
+		key := labelKey(e.labels)
+		g, ok := groups[key]
+		if !ok {
+			stream, tenant := splitTenant(e.labels)
+			g = &streamGroup{labels: stream, tenant: tenant}
+			groups[key] = g
+		}
+		g.values = append(g.values, []string{
+			fmt.Sprintf("%d", e.timestamp.UnixNano()),
+			string(e.content),
+		})
+	}
+
+	tenants := make(map[string]*client.LokiEntry)
+	for _, g := range groups {
+		lokiEntry, ok := tenants[g.tenant]
+		if !ok {
+			lokiEntry = &client.LokiEntry{Tenant: g.tenant}
+			tenants[g.tenant] = lokiEntry
+		}
+		lokiEntry.Streams = append(lokiEntry.Streams, client.LokiStream{
+			Stream: g.labels,
+			Values: g.values,
+		})
+	}
+
+	var chunks []client.LokiEntry
+	for _, lokiEntry := range tenants {
+		chunks = append(chunks, splitEntry(*lokiEntry, w.s.maxBatchBytes)...)
+	}
+
+	release := w.s.newBatchRelease(batch, len(chunks))
+	for _, chunk := range chunks {
+		w.dispatch(chunk, release)
+	}
+}
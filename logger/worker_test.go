@@ -0,0 +1,94 @@
+package logger
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mwazovzky/cloudlog/client"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// slowLogSender records the highest number of concurrent pushes
+type slowLogSender struct {
+	asyncMockLogSender
+	inFlight    atomic.Int32
+	maxInFlight atomic.Int32
+}
+
+func (s *slowLogSender) Send(ctx context.Context, entry client.LokiEntry) error {
+	n := s.inFlight.Add(1)
+	defer s.inFlight.Add(-1)
+	for {
+		peak := s.maxInFlight.Load()
+		if n <= peak || s.maxInFlight.CompareAndSwap(peak, n) {
+			break
+		}
+	}
+
+	time.Sleep(5 * time.Millisecond)
+	return s.asyncMockLogSender.Send(ctx, entry)
+}
+
+func TestAsyncSender_WorkersSendConcurrently(t *testing.T) {
+	mock := &slowLogSender{}
+	sender := NewAsyncSender(mock, WithWorkers(4), WithBatchSize(1))
+
+	for i := 0; i < 40; i++ {
+		labels := map[string]string{"job": "test", "user": strconv.Itoa(i)}
+		require.NoError(t, sender.Send(ctx, []byte(fmt.Sprintf(`{"i":%d}`, i)), labels, time.Now()))
+	}
+	sender.Close()
+
+	assert.Equal(t, 40, mock.totalValues())
+	assert.Greater(t, mock.maxInFlight.Load(), int32(1))
+}
+
+func TestAsyncSender_WorkersKeepStreamOrder(t *testing.T) {
+	mock := &slowLogSender{}
+	sender := NewAsyncSender(mock, WithWorkers(4), WithBatchSize(3), WithBufferSize(1000))
+
+	start := time.Now()
+	for i := 0; i < 50; i++ {
+		for stream := 0; stream < 8; stream++ {
+			labels := map[string]string{"job": "test", "stream": strconv.Itoa(stream)}
+			require.NoError(t, sender.Send(ctx, []byte("line"), labels, start.Add(time.Duration(i)*time.Millisecond)))
+		}
+	}
+	sender.Close()
+
+	// Pushes are recorded in the order they reached the client
+	last := make(map[string]int64)
+	for _, e := range mock.getEntries() {
+		for _, s := range e.Streams {
+			for _, v := range s.Values {
+				ts, err := strconv.ParseInt(v[0], 10, 64)
+				require.NoError(t, err)
+				assert.Greater(t, ts, last[s.Stream["stream"]], "stream %s out of order", s.Stream["stream"])
+				last[s.Stream["stream"]] = ts
+			}
+		}
+	}
+	assert.Equal(t, 400, mock.totalValues())
+}
+
+func TestAsyncSender_WorkerForIsStable(t *testing.T) {
+	sender := NewAsyncSender(&asyncMockLogSender{}, WithWorkers(8), WithBufferSize(80))
+	defer sender.Close()
+
+	require.Len(t, sender.workers, 8)
+	assert.Equal(t, 10, cap(sender.workers[0].buffer))
+
+	seen := make(map[*worker]bool)
+	for i := 0; i < 100; i++ {
+		labels := map[string]string{"job": "test", "user": strconv.Itoa(i)}
+		w := sender.workerFor(labels)
+		assert.Same(t, w, sender.workerFor(map[string]string{"user": strconv.Itoa(i), "job": "test"}))
+		seen[w] = true
+	}
+	assert.Greater(t, len(seen), 1)
+}
@@ -0,0 +1,76 @@
+package metrics
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// LatencyBounds are the upper bounds of the Histogram buckets, the Prometheus
+// default buckets from 5ms to 10s
+var LatencyBounds = [...]time.Duration{
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	2500 * time.Millisecond,
+	5 * time.Second,
+	10 * time.Second,
+}
+
+// Histogram records durations in the LatencyBounds buckets. The zero value is
+// ready to use and all methods are safe for concurrent use. Buckets are stored
+// individually and made cumulative by Snapshot.
+type Histogram struct {
+	buckets [len(LatencyBounds)]atomic.Uint64
+	count   atomic.Uint64
+	sum     atomic.Int64 // nanoseconds
+}
+
+// HistogramSnapshot is a cumulative histogram of durations
+type HistogramSnapshot struct {
+	// Buckets holds, for each upper bound, the number of observations of at most that duration
+	Buckets []Bucket
+	// Count is the total number of observations
+	Count uint64
+	// Sum is the total of all observed durations
+	Sum time.Duration
+}
+
+// Bucket is one bucket of a HistogramSnapshot
+type Bucket struct {
+	UpperBound time.Duration
+	Count      uint64
+}
+
+// Observe records one duration
+func (h *Histogram) Observe(d time.Duration) {
+	for i, bound := range LatencyBounds {
+		if d <= bound {
+			h.buckets[i].Add(1)
+			break
+		}
+	}
+	h.count.Add(1)
+	h.sum.Add(int64(d))
+}
+
+// Snapshot returns the cumulative bucket counts, the count and the sum.
+// Counters are read individually, so a snapshot taken while durations are
+// observed may be slightly inconsistent.
+func (h *Histogram) Snapshot() HistogramSnapshot {
+	snap := HistogramSnapshot{
+		Buckets: make([]Bucket, len(LatencyBounds)),
+		Count:   h.count.Load(),
+		Sum:     time.Duration(h.sum.Load()),
+	}
+	var cumulative uint64
+	for i, bound := range LatencyBounds {
+		cumulative += h.buckets[i].Load()
+		snap.Buckets[i] = Bucket{UpperBound: bound, Count: cumulative}
+	}
+	return snap
+}
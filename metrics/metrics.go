@@ -0,0 +1,160 @@
+// Package metrics collects cloudlog pipeline metrics and serves them in the
+// Prometheus text exposition format, without depending on the Prometheus client.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Registry holds the metrics of one or more loggers, clients and senders.
+// It implements http.Handler; all methods are safe for concurrent use.
+type Registry struct {
+	mu       sync.Mutex
+	entries  map[entryKey]uint64
+	statuses map[string]uint64
+	buffers  []func() (depth, capacity int)
+
+	bytesOut atomic.Uint64
+	latency  Histogram
+}
+
+type entryKey struct {
+	level string
+	job   string
+}
+
+// NewRegistry creates an empty Registry
+func NewRegistry() *Registry {
+	return &Registry{
+		entries:  make(map[entryKey]uint64),
+		statuses: make(map[string]uint64),
+	}
+}
+
+// ObserveEntry counts a log entry passed to a sender
+func (r *Registry) ObserveEntry(level, job string) {
+	r.mu.Lock()
+	r.entries[entryKey{level: level, job: job}]++
+	r.mu.Unlock()
+}
+
+// ObservePush records one HTTP push attempt: the response status code (0 when
+// no response was received), the request body size and the attempt's duration
+func (r *Registry) ObservePush(statusCode int, bytes int, d time.Duration) {
+	status := "error"
+	if statusCode > 0 {
+		status = strconv.Itoa(statusCode)
+	}
+	r.mu.Lock()
+	r.statuses[status]++
+	r.mu.Unlock()
+
+	r.bytesOut.Add(uint64(bytes))
+
+	r.latency.Observe(d)
+}
+
+// RegisterBuffer adds a sender buffer whose fill is reported on every scrape.
+// Buffers of all registered senders are summed.
+func (r *Registry) RegisterBuffer(fill func() (depth, capacity int)) {
+	r.mu.Lock()
+	r.buffers = append(r.buffers, fill)
+	r.mu.Unlock()
+}
+
+// ServeHTTP writes all metrics in the Prometheus text exposition format
+func (r *Registry) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_ = r.Write(w)
+}
+
+// Write writes all metrics in the Prometheus text exposition format
+func (r *Registry) Write(w io.Writer) error {
+	r.mu.Lock()
+	entries := make(map[entryKey]uint64, len(r.entries))
+	for k, v := range r.entries {
+		entries[k] = v
+	}
+	statuses := make(map[string]uint64, len(r.statuses))
+	for k, v := range r.statuses {
+		statuses[k] = v
+	}
+	buffers := append([]func() (int, int){}, r.buffers...)
+	r.mu.Unlock()
+
+	bw := bufio.NewWriter(w)
+
+	header(bw, "cloudlog_entries_total", "counter", "Log entries passed to a sender, by level and job.")
+	keys := make([]entryKey, 0, len(entries))
+	for k := range entries {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].job != keys[j].job {
+			return keys[i].job < keys[j].job
+		}
+		return keys[i].level < keys[j].level
+	})
+	for _, k := range keys {
+		fmt.Fprintf(bw, "cloudlog_entries_total{job=%s,level=%s} %d\n", quote(k.job), quote(k.level), entries[k])
+	}
+
+	header(bw, "cloudlog_push_requests_total", "counter", `Loki push attempts, by HTTP status code ("error" when no response was received).`)
+	codes := make([]string, 0, len(statuses))
+	for code := range statuses {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	for _, code := range codes {
+		fmt.Fprintf(bw, "cloudlog_push_requests_total{code=%s} %d\n", quote(code), statuses[code])
+	}
+
+	header(bw, "cloudlog_sent_bytes_total", "counter", "Bytes of push request bodies sent to Loki, after compression.")
+	fmt.Fprintf(bw, "cloudlog_sent_bytes_total %d\n", r.bytesOut.Load())
+
+	header(bw, "cloudlog_push_duration_seconds", "histogram", "Duration of Loki push attempts.")
+	latency := r.latency.Snapshot()
+	for _, b := range latency.Buckets {
+		fmt.Fprintf(bw, "cloudlog_push_duration_seconds_bucket{le=%s} %d\n", quote(formatFloat(b.UpperBound.Seconds())), b.Count)
+	}
+	fmt.Fprintf(bw, "cloudlog_push_duration_seconds_bucket{le=\"+Inf\"} %d\n", latency.Count)
+	fmt.Fprintf(bw, "cloudlog_push_duration_seconds_sum %s\n", formatFloat(latency.Sum.Seconds()))
+	fmt.Fprintf(bw, "cloudlog_push_duration_seconds_count %d\n", latency.Count)
+
+	depth, capacity := 0, 0
+	for _, fill := range buffers {
+		d, c := fill()
+		depth += d
+		capacity += c
+	}
+	header(bw, "cloudlog_buffer_entries", "gauge", "Entries waiting in AsyncSender buffers.")
+	fmt.Fprintf(bw, "cloudlog_buffer_entries %d\n", depth)
+	header(bw, "cloudlog_buffer_capacity", "gauge", "Capacity of AsyncSender buffers, in entries.")
+	fmt.Fprintf(bw, "cloudlog_buffer_capacity %d\n", capacity)
+
+	return bw.Flush()
+}
+
+func header(w io.Writer, name, kind, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// labelEscaper escapes label values as required by the exposition format
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func quote(value string) string {
+	return `"` + labelEscaper.Replace(value) + `"`
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
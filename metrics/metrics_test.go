@@ -0,0 +1,103 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func scrape(t *testing.T, r *Registry) string {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "text/plain; version=0.0.4; charset=utf-8", rec.Header().Get("Content-Type"))
+	return rec.Body.String()
+}
+
+func TestRegistry_Exposition(t *testing.T) {
+	r := NewRegistry()
+	r.ObserveEntry("info", "api")
+	r.ObserveEntry("info", "api")
+	r.ObserveEntry("error", "worker")
+	r.ObservePush(204, 100, 3*time.Millisecond)
+	r.ObservePush(500, 50, 300*time.Millisecond)
+	r.ObservePush(0, 50, 20*time.Second)
+	r.RegisterBuffer(func() (int, int) { return 3, 10 })
+	r.RegisterBuffer(func() (int, int) { return 1, 10 })
+
+	out := scrape(t, r)
+
+	for _, line := range []string{
+		"# TYPE cloudlog_entries_total counter",
+		`cloudlog_entries_total{job="api",level="info"} 2`,
+		`cloudlog_entries_total{job="worker",level="error"} 1`,
+		`cloudlog_push_requests_total{code="204"} 1`,
+		`cloudlog_push_requests_total{code="500"} 1`,
+		`cloudlog_push_requests_total{code="error"} 1`,
+		"cloudlog_sent_bytes_total 200",
+		"# TYPE cloudlog_push_duration_seconds histogram",
+		`cloudlog_push_duration_seconds_bucket{le="0.005"} 1`,
+		`cloudlog_push_duration_seconds_bucket{le="0.25"} 1`,
+		`cloudlog_push_duration_seconds_bucket{le="0.5"} 2`,
+		`cloudlog_push_duration_seconds_bucket{le="10"} 2`,
+		`cloudlog_push_duration_seconds_bucket{le="+Inf"} 3`,
+		"cloudlog_push_duration_seconds_sum 20.303",
+		"cloudlog_push_duration_seconds_count 3",
+		"cloudlog_buffer_entries 4",
+		"cloudlog_buffer_capacity 20",
+	} {
+		assert.Contains(t, out, line+"\n")
+	}
+}
+
+func TestHistogram_Snapshot(t *testing.T) {
+	var h Histogram
+	h.Observe(5 * time.Millisecond)
+	h.Observe(300 * time.Millisecond)
+	h.Observe(20 * time.Second)
+
+	snap := h.Snapshot()
+	assert.Equal(t, uint64(3), snap.Count)
+	assert.Equal(t, 20305*time.Millisecond, snap.Sum)
+	require.Len(t, snap.Buckets, len(LatencyBounds))
+	assert.Equal(t, Bucket{UpperBound: 5 * time.Millisecond, Count: 1}, snap.Buckets[0])
+	assert.Equal(t, Bucket{UpperBound: 500 * time.Millisecond, Count: 2}, snap.Buckets[6])
+	assert.Equal(t, Bucket{UpperBound: 10 * time.Second, Count: 2}, snap.Buckets[len(snap.Buckets)-1])
+}
+
+func TestRegistry_EscapesLabelValues(t *testing.T) {
+	r := NewRegistry()
+	r.ObserveEntry("info", "a\"b\\c\nd")
+
+	assert.Contains(t, scrape(t, r), `cloudlog_entries_total{job="a\"b\\c\nd",level="info"} 1`)
+}
+
+func TestRegistry_ConcurrentUse(t *testing.T) {
+	r := NewRegistry()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				r.ObserveEntry("info", "api")
+				r.ObservePush(204, 10, time.Millisecond)
+				var sb strings.Builder
+				_ = r.Write(&sb)
+			}
+		}()
+	}
+	wg.Wait()
+
+	out := scrape(t, r)
+	assert.Contains(t, out, `cloudlog_entries_total{job="api",level="info"} 400`+"\n")
+	assert.Contains(t, out, "cloudlog_push_duration_seconds_count 400\n")
+}
@@ -0,0 +1,173 @@
+// Package middleware provides net/http middleware that logs requests through a cloudlog Logger.
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"time"
+
+	"github.com/mwazovzky/cloudlog/logger"
+)
+
+// maxRequestIDLength bounds request IDs taken from the request header
+const maxRequestIDLength = 128
+
+// config holds the middleware settings
+type config struct {
+	requestIDHeader string
+	newRequestID    func() string
+}
+
+// Option configures the middleware
+type Option func(*config)
+
+// WithRequestIDHeader sets the header a request ID is read from and echoed in (default X-Request-ID)
+func WithRequestIDHeader(name string) Option {
+	return func(c *config) {
+		if name != "" {
+			c.requestIDHeader = name
+		}
+	}
+}
+
+// WithRequestIDGenerator sets the function that creates request IDs for
+// requests without one (default: 16 random bytes, hex encoded)
+func WithRequestIDGenerator(generate func() string) Option {
+	return func(c *config) {
+		if generate != nil {
+			c.newRequestID = generate
+		}
+	}
+}
+
+// New returns middleware that logs one entry per request with the fields
+// method, path, status, bytes, duration_ms and remote_addr. Select the fields
+// to promote to Loki labels with the logger's WithLabelKeys option.
+//
+// Each request gets a request ID, taken from the request header or generated,
+// which is echoed in the response. Handlers can retrieve a logger carrying it
+// with logger.FromContext(r.Context()); a W3C traceparent header is added to
+// the context as well. Panics are logged at error level with their stack and,
+// if no header was written yet, answered with 500; http.ErrAbortHandler is
+// re-raised.
+func New(l logger.Logger, options ...Option) func(http.Handler) http.Handler {
+	cfg := &config{
+		requestIDHeader: "X-Request-ID",
+		newRequestID:    newRequestID,
+	}
+	for _, option := range options {
+		option(cfg)
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+
+			requestID := r.Header.Get(cfg.requestIDHeader)
+			if requestID == "" || len(requestID) > maxRequestIDLength {
+				requestID = cfg.newRequestID()
+			}
+			w.Header().Set(cfg.requestIDHeader, requestID)
+
+			reqLogger := l.With("request_id", requestID)
+			ctx := logger.ContextWithRequestID(r.Context(), requestID)
+			if tc, err := logger.ParseTraceparent(r.Header.Get("traceparent")); err == nil {
+				ctx = logger.ContextWithTraceContext(ctx, tc)
+			}
+			ctx = logger.NewContext(ctx, reqLogger)
+			r = r.WithContext(ctx)
+
+			rec := &responseRecorder{ResponseWriter: w}
+			defer func() {
+				if v := recover(); v != nil {
+					if v == http.ErrAbortHandler {
+						panic(v)
+					}
+					_ = reqLogger.Error(ctx, "panic recovered",
+						"panic", fmt.Sprint(v),
+						"stack", string(debug.Stack()),
+					)
+					// Once headers are written the client already has the status, so it is logged as sent
+					if !rec.wroteHeader {
+						http.Error(rec, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+					}
+				}
+
+				status := rec.statusCode()
+				keyvals := []interface{}{
+					"method", r.Method,
+					"path", r.URL.Path,
+					"status", status,
+					"bytes", rec.bytes,
+					"duration_ms", float64(time.Since(start).Microseconds()) / 1000,
+					"remote_addr", r.RemoteAddr,
+				}
+				if status >= http.StatusInternalServerError {
+					_ = reqLogger.Error(ctx, "http request", keyvals...)
+				} else {
+					_ = reqLogger.Info(ctx, "http request", keyvals...)
+				}
+			}()
+
+			next.ServeHTTP(rec, r)
+		})
+	}
+}
+
+// responseRecorder captures the status code and body size of a response
+type responseRecorder struct {
+	http.ResponseWriter
+	status      int
+	bytes       int
+	wroteHeader bool
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.status = status
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	if !r.wroteHeader {
+		r.WriteHeader(http.StatusOK)
+	}
+	n, err := r.ResponseWriter.Write(b)
+	r.bytes += n
+	return n, err
+}
+
+// Flush implements http.Flusher for streaming handlers
+func (r *responseRecorder) Flush() {
+	if !r.wroteHeader {
+		r.WriteHeader(http.StatusOK)
+	}
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap gives http.ResponseController access to the underlying writer
+func (r *responseRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// statusCode returns the response status, 200 if the handler never set one
+func (r *responseRecorder) statusCode() int {
+	if r.status == 0 {
+		return http.StatusOK
+	}
+	return r.status
+}
+
+// newRequestID returns 16 random bytes, hex encoded
+func newRequestID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
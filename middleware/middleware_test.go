@@ -0,0 +1,151 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mwazovzky/cloudlog/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// captureSender records the entries sent by a logger
+type captureSender struct {
+	mu      sync.Mutex
+	entries []map[string]interface{}
+	labels  []map[string]string
+}
+
+func (s *captureSender) Send(_ context.Context, content []byte, labels map[string]string, _ time.Time) error {
+	var data map[string]interface{}
+	if err := json.Unmarshal(content, &data); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries = append(s.entries, data)
+	s.labels = append(s.labels, labels)
+	return nil
+}
+
+func TestMiddleware_LogsRequest(t *testing.T) {
+	sender := &captureSender{}
+	log := logger.New(sender, logger.WithJob("api"), logger.WithLabelKeys("method", "status"))
+
+	handler := New(log)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte("hello"))
+	}))
+
+	req := httptest.NewRequest(http.MethodPost, "/orders?id=1", nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	require.Len(t, sender.entries, 1)
+	entry := sender.entries[0]
+	assert.Equal(t, "http request", entry["message"])
+	assert.Equal(t, "info", entry["level"])
+	assert.Equal(t, "/orders", entry["path"])
+	assert.Equal(t, float64(5), entry["bytes"])
+	assert.Equal(t, "10.0.0.1:1234", entry["remote_addr"])
+	assert.Contains(t, entry, "duration_ms")
+	assert.Equal(t, rec.Header().Get("X-Request-ID"), entry["request_id"])
+	assert.Len(t, entry["request_id"], 32)
+
+	// Label keys promote the chosen fields
+	assert.Equal(t, map[string]string{"job": "api", "method": "POST", "status": "201"}, sender.labels[0])
+	assert.NotContains(t, entry, "method")
+}
+
+func TestMiddleware_RequestScopedLogger(t *testing.T) {
+	sender := &captureSender{}
+	mw := New(logger.New(sender), WithRequestIDHeader("X-Correlation-ID"))
+
+	handler := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		_ = logger.FromContext(ctx).Info(ctx, "inside handler")
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-Correlation-ID", "abc-123")
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	assert.Equal(t, "abc-123", rec.Header().Get("X-Correlation-ID"))
+	require.Len(t, sender.entries, 2)
+	for _, entry := range sender.entries {
+		assert.Equal(t, "abc-123", entry["request_id"])
+		assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", entry["trace_id"])
+	}
+	assert.Equal(t, "inside handler", sender.entries[0]["message"])
+	assert.Equal(t, float64(http.StatusOK), sender.entries[1]["status"])
+}
+
+func TestMiddleware_GeneratedRequestID(t *testing.T) {
+	sender := &captureSender{}
+	mw := New(logger.New(sender), WithRequestIDGenerator(func() string { return "generated" }))
+	handler := mw(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+
+	// Oversized incoming IDs are replaced
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-Request-ID", string(make([]byte, maxRequestIDLength+1)))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	assert.Equal(t, "generated", rec.Header().Get("X-Request-ID"))
+	assert.Equal(t, "generated", sender.entries[0]["request_id"])
+}
+
+func TestMiddleware_RecoversPanic(t *testing.T) {
+	sender := &captureSender{}
+	handler := New(logger.New(sender))(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		panic("boom")
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/panic", nil))
+
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	require.Len(t, sender.entries, 2)
+	assert.Equal(t, "panic recovered", sender.entries[0]["message"])
+	assert.Equal(t, "error", sender.entries[0]["level"])
+	assert.Equal(t, "boom", sender.entries[0]["panic"])
+	assert.Contains(t, sender.entries[0]["stack"], "middleware_test.go")
+	assert.Equal(t, "error", sender.entries[1]["level"])
+	assert.Equal(t, float64(http.StatusInternalServerError), sender.entries[1]["status"])
+}
+
+func TestMiddleware_PanicAfterHeaderLogsSentStatus(t *testing.T) {
+	sender := &captureSender{}
+	handler := New(logger.New(sender))(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+		panic("boom")
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/panic", nil))
+
+	assert.Equal(t, http.StatusAccepted, rec.Code)
+	require.Len(t, sender.entries, 2)
+	assert.Equal(t, "panic recovered", sender.entries[0]["message"])
+	assert.Equal(t, "error", sender.entries[0]["level"])
+	assert.Equal(t, float64(http.StatusAccepted), sender.entries[1]["status"])
+}
+
+func TestMiddleware_ReraisesAbortHandler(t *testing.T) {
+	sender := &captureSender{}
+	handler := New(logger.New(sender))(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		panic(http.ErrAbortHandler)
+	}))
+
+	assert.PanicsWithValue(t, http.ErrAbortHandler, func() {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	})
+}